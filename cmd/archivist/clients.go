@@ -0,0 +1,86 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"strings"
+
+	"github.com/openshift/online/archivist/pkg/config"
+
+	buildclient "github.com/openshift/origin/pkg/build/client/clientset_generated/internalclientset/typed/core/internalversion"
+	osclient "github.com/openshift/origin/pkg/client"
+
+	kclientset "k8s.io/kubernetes/pkg/client/clientset_generated/internalclientset"
+	"k8s.io/kubernetes/pkg/client/restclient"
+	kclientcmd "k8s.io/kubernetes/pkg/client/unversioned/clientcmd"
+
+	log "github.com/Sirupsen/logrus"
+)
+
+// clusterClients holds the API clients for a single cluster. Every cluster gets its own clients so a problem
+// with one cluster's connection cannot affect the others.
+type clusterClients struct {
+	oc osclient.Interface
+	kc kclientset.Interface
+	bc buildclient.CoreInterface
+}
+
+// clientConfigForCluster returns the REST client configuration for a cluster's connection settings.
+func clientConfigForCluster(cc config.ClusterConfig) (*restclient.Config, error) {
+	conn := cc.Connection
+	switch conn.Mode {
+	case config.InClusterConnection:
+		return restclient.InClusterConfig()
+	case config.TokenConnection:
+		token, err := ioutil.ReadFile(conn.TokenFile)
+		if err != nil {
+			return nil, fmt.Errorf("error reading token file: %s", err)
+		}
+		return &restclient.Config{
+			Host:        conn.Server,
+			BearerToken: strings.TrimSpace(string(token)),
+			TLSClientConfig: restclient.TLSClientConfig{
+				CAFile: conn.CAFile,
+			},
+		}, nil
+	case config.KubeconfigConnection:
+		rules := kclientcmd.NewDefaultClientConfigLoadingRules()
+		rules.ExplicitPath = conn.Kubeconfig
+		overrides := &kclientcmd.ConfigOverrides{CurrentContext: conn.Context}
+		return kclientcmd.NewNonInteractiveDeferredLoadingClientConfig(rules, overrides).ClientConfig()
+	default:
+		return nil, fmt.Errorf("invalid connection mode: %s", conn.Mode)
+	}
+}
+
+func newClusterClients(cc config.ClusterConfig) (*clusterClients, error) {
+	clientConfig, err := clientConfigForCluster(cc)
+	if err != nil {
+		return nil, err
+	}
+
+	log.WithFields(log.Fields{
+		"cluster":  cc.Name,
+		"mode":     cc.Connection.Mode,
+		"APIPath":  clientConfig.APIPath,
+		"CertFile": clientConfig.CertFile,
+		"KeyFile":  clientConfig.KeyFile,
+		"CAFile":   clientConfig.CAFile,
+		"Host":     clientConfig.Host,
+		"Username": clientConfig.Username,
+	}).Infoln("Created OpenShift client clientConfig:")
+
+	oc, err := osclient.New(clientConfig)
+	if err != nil {
+		return nil, err
+	}
+	kc, err := kclientset.NewForConfig(clientConfig)
+	if err != nil {
+		return nil, err
+	}
+	bc, err := buildclient.NewForConfig(clientConfig)
+	if err != nil {
+		return nil, err
+	}
+	return &clusterClients{oc: oc, kc: kc, bc: bc}, nil
+}
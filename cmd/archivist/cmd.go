@@ -2,25 +2,36 @@ package main
 
 import (
 	"flag"
+	"fmt"
 	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+	"time"
 
+	"github.com/openshift/online/archivist/pkg/activitystore"
+	"github.com/openshift/online/archivist/pkg/archiver"
+	"github.com/openshift/online/archivist/pkg/archivestore"
 	"github.com/openshift/online/archivist/pkg/clustermonitor"
 	"github.com/openshift/online/archivist/pkg/config"
-
-	buildclient "github.com/openshift/origin/pkg/build/client/clientset_generated/internalclientset/typed/core/internalversion"
-	osclient "github.com/openshift/origin/pkg/client"
-	"github.com/openshift/origin/pkg/cmd/util/clientcmd"
-
-	kclientset "k8s.io/kubernetes/pkg/client/clientset_generated/internalclientset"
+	"github.com/openshift/online/archivist/pkg/leaderelection"
 
 	log "github.com/Sirupsen/logrus"
-	"github.com/spf13/pflag"
 )
 
+// clusterRetryInterval is how long to wait before retrying a cluster whose monitor could not be started.
+const clusterRetryInterval = time.Minute
+
 func main() {
 	log.SetOutput(os.Stdout)
 	var cfgFile string
+	var restoreNamespace string
+	var restoreCluster string
+	var dryRun bool
 	flag.StringVar(&cfgFile, "config", "", "load configuration from file")
+	flag.StringVar(&restoreNamespace, "restore", "", "restore the given namespace from its archive and exit")
+	flag.StringVar(&restoreCluster, "cluster", "", "name of the cluster to restore to, if multiple are configured")
+	flag.BoolVar(&dryRun, "dry-run", false, "log namespaces which would be archived without archiving them")
 	flag.Parse()
 
 	var archivistCfg config.ArchivistConfig
@@ -38,50 +49,245 @@ func main() {
 			log.Panicf("invalid configuration: %s", err)
 		}
 	}
+	if dryRun {
+		archivistCfg.DryRun = true
+	}
 	if lvl, err := log.ParseLevel(archivistCfg.LogLevel); err != nil {
 		log.Panic(err)
 	} else {
 		log.SetLevel(lvl)
 	}
 	log.Infoln("Using configuration:", archivistCfg)
+	if archivistCfg.DryRun {
+		log.Warnln("dry run mode enabled, no namespaces will be archived")
+	}
+
+	if restoreNamespace != "" {
+		cc, err := findCluster(archivistCfg, restoreCluster)
+		if err != nil {
+			log.Fatal(err)
+		}
+		if err := restore(archivistCfg, cc, restoreNamespace); err != nil {
+			log.Fatalf("error restoring namespace %s: %s", restoreNamespace, err)
+		}
+		return
+	}
 
-	// TODO: make use of for real deployments
-	// conf, err := restclient.InClusterConfig()
-	dcc := clientcmd.DefaultClientConfig(pflag.NewFlagSet("empty", pflag.ContinueOnError))
-	clientFac := clientcmd.NewFactory(dcc)
-	clientConfig, err := dcc.ClientConfig()
+	activityStore, err := activitystore.Open(archivistCfg.ActivityStore.Path)
 	if err != nil {
-		log.Panicf("error creating cluster clientConfig: %s", err)
+		log.Fatal(err)
+	}
+	defer activityStore.Close()
+
+	clusterNames := make([]string, 0, len(archivistCfg.Clusters))
+	for _, cc := range archivistCfg.Clusters {
+		clusterNames = append(clusterNames, cc.Name)
 	}
+	health := newHealthChecker(clusterNames)
+	startHTTPServer(archivistCfg.ListenAddress, health)
+
+	stopChan := make(chan struct{})
+	// Tracks every goroutine which must finish before the activity store is closed:
+	var wg sync.WaitGroup
+	for _, cc := range archivistCfg.Clusters {
+		wg.Add(1)
+		go func(cc config.ClusterConfig) {
+			defer wg.Done()
+			startClusterMonitor(archivistCfg, cc, activityStore, health, &wg, stopChan)
+		}(cc)
+	}
+
+	log.Infoln("all components running")
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGTERM, os.Interrupt)
+	sig := <-signals
+	log.WithFields(log.Fields{"signal": sig}).Infoln("shutting down")
+	close(stopChan)
+	wg.Wait()
+	log.Infoln("shutdown complete")
+}
 
-	log.WithFields(log.Fields{
-		"APIPath":  clientConfig.APIPath,
-		"CertFile": clientConfig.CertFile,
-		"KeyFile":  clientConfig.KeyFile,
-		"CAFile":   clientConfig.CAFile,
-		"Host":     clientConfig.Host,
-		"Username": clientConfig.Username,
-	}).Infoln("Created OpenShift client clientConfig:")
+// startClusterMonitor runs the monitor for a single cluster, retrying until it can be started. A cluster which
+// cannot be reached does not prevent the others from being monitored.
+func startClusterMonitor(archivistCfg config.ArchivistConfig, cc config.ClusterConfig,
+	activityStore *activitystore.Store, health *healthChecker, wg *sync.WaitGroup, stopChan <-chan struct{}) {
+
+	for {
+		err := runClusterMonitor(archivistCfg, cc, activityStore, health, wg, stopChan)
+		if err == nil {
+			return
+		}
+		log.WithFields(log.Fields{"cluster": cc.Name}).Errorf(
+			"error starting cluster monitor, retrying in %s: %s", clusterRetryInterval, err)
+		select {
+		case <-stopChan:
+			return
+		case <-time.After(clusterRetryInterval):
+		}
+	}
+}
 
-	var oc osclient.Interface
-	var kc kclientset.Interface
+// runClusterMonitor starts monitoring the cluster, adding the goroutines it starts to wg so they can be waited for
+// once stopChan is closed.
+func runClusterMonitor(archivistCfg config.ArchivistConfig, cc config.ClusterConfig,
+	activityStore *activitystore.Store, health *healthChecker, wg *sync.WaitGroup, stopChan <-chan struct{}) error {
 
-	oc, kc, err = clientFac.Clients()
+	clients, err := newClusterClients(cc)
+	if err != nil {
+		return fmt.Errorf("error creating OpenShift/Kubernetes clients: %s", err)
+	}
+	store, err := archivestore.NewArchiveStore(archivistCfg.ClusterArchiveStore(cc))
+	if err != nil {
+		return fmt.Errorf("error creating archive store: %s", err)
+	}
+	// Shared by every monitor for the cluster, so activity is kept across monitor retries and leadership changes:
+	activity, err := activityStore.Cluster(cc.Name)
 	if err != nil {
-		log.Panicf("error creating OpenShift/Kubernetes clients: %s", err)
+		return err
+	}
+
+	// goTracked runs f in a goroutine which is waited for on shutdown, so activity is flushed before the store is closed:
+	goTracked := func(f func()) {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			f()
+		}()
+	}
+
+	if !archivistCfg.LeaderElection.Enabled {
+		goTracked(func() { activity.Run(archivistCfg.ActivityStore.FlushInterval, stopChan) })
+		goTracked(func() { monitorCluster(archivistCfg, cc, clients, store, activity, health, nil, stopChan) })
+		return nil
 	}
 
-	var bc buildclient.CoreInterface
-	bc, err = buildclient.NewForConfig(clientConfig)
+	le := archivistCfg.LeaderElection
+	identity, err := leaderIdentity()
 	if err != nil {
-		log.Panicf("Error creating OpenShift client: %s", err)
+		return err
 	}
+	elector, err := leaderelection.NewLeaderElector(
+		leaderelection.NewConfigMapLock(clients.kc, le.Namespace, le.Name),
+		identity, le.LeaseDuration, le.RenewDeadline, le.RetryPeriod)
+	if err != nil {
+		return err
+	}
+	log.WithFields(log.Fields{"cluster": cc.Name, "identity": identity}).Infoln(
+		"tracking activity, waiting for leadership before archiving")
+	// Every replica tracks activity in its own store, so whichever becomes leader has the full history:
+	term := &leaderTerm{}
+	goTracked(func() { activity.Run(archivistCfg.ActivityStore.FlushInterval, stopChan) })
+	goTracked(func() { monitorCluster(archivistCfg, cc, clients, store, activity, health, term.leading, stopChan) })
+	goTracked(func() { elector.Run(stopChan, term.set) })
+	return nil
+}
 
-	stopChan := make(chan struct{})
+// monitorCluster runs a monitor for the cluster until stopChan is closed. A monitor whose caches fail to sync is
+// stopped and replaced with a new one, with its own informers, after clusterRetryInterval. With leader election,
+// leading reports whether the monitor may archive, otherwise it is nil.
+func monitorCluster(archivistCfg config.ArchivistConfig, cc config.ClusterConfig, clients *clusterClients,
+	store archivestore.ArchiveStore, activity *activitystore.ClusterStore, health *healthChecker,
+	leading func() bool, stopChan <-chan struct{}) {
 
-	activityMonitor := clustermonitor.NewClusterMonitor(archivistCfg, archivistCfg.Clusters[0], oc, kc, bc)
-	activityMonitor.Run(stopChan)
+	for {
+		monitorStop := make(chan struct{})
+		failed := make(chan struct{})
+		go func() {
+			select {
+			case <-stopChan:
+			case <-failed:
+			}
+			close(monitorStop)
+		}()
 
-	log.Infoln("all components running")
-	<-stopChan
+		nsArchiver := archiver.NewArchiver(cc, store, clients.oc, clients.kc)
+		activityMonitor, err := clustermonitor.NewClusterMonitor(archivistCfg, cc, clients.oc, clients.kc, clients.bc,
+			nsArchiver, activity)
+		if err == nil {
+			if leading != nil {
+				activityMonitor.SetLeading(leading)
+			}
+			health.setMonitor(cc.Name, activityMonitor)
+			err = activityMonitor.Run(monitorStop)
+			if err == nil {
+				<-stopChan
+				return
+			}
+		}
+		close(failed)
+		log.WithFields(log.Fields{"cluster": cc.Name}).Errorf(
+			"cluster monitor failed, retrying in %s: %s", clusterRetryInterval, err)
+		select {
+		case <-stopChan:
+			return
+		case <-time.After(clusterRetryInterval):
+		}
+	}
+}
+
+// leaderTerm holds this replica's current term of leadership for a cluster.
+type leaderTerm struct {
+	mutex sync.Mutex
+	// stop is closed when the term ends, nil if there has been no term:
+	stop <-chan struct{}
+}
+
+// set starts a new term, called by the leader elector each time leadership is acquired.
+func (t *leaderTerm) set(stop <-chan struct{}) {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	t.stop = stop
+}
+
+// leading returns true while the current term has not ended.
+func (t *leaderTerm) leading() bool {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	if t.stop == nil {
+		return false
+	}
+	select {
+	case <-t.stop:
+		return false
+	default:
+		return true
+	}
+}
+
+// leaderIdentity identifies this replica in leader elections. When running in a pod the hostname is the pod name.
+func leaderIdentity() (string, error) {
+	hostname, err := os.Hostname()
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("%s_%d", hostname, os.Getpid()), nil
+}
+
+func restore(archivistCfg config.ArchivistConfig, cc config.ClusterConfig, namespace string) error {
+	clients, err := newClusterClients(cc)
+	if err != nil {
+		return fmt.Errorf("error creating OpenShift/Kubernetes clients: %s", err)
+	}
+	store, err := archivestore.NewArchiveStore(archivistCfg.ClusterArchiveStore(cc))
+	if err != nil {
+		return fmt.Errorf("error creating archive store: %s", err)
+	}
+	return archiver.NewRestorer(cc, store, clients.oc, clients.kc).Restore(namespace)
+}
+
+// findCluster returns the configuration for the named cluster. The name may be omitted if only one cluster
+// is configured.
+func findCluster(archivistCfg config.ArchivistConfig, name string) (config.ClusterConfig, error) {
+	if name == "" {
+		if len(archivistCfg.Clusters) != 1 {
+			return config.ClusterConfig{}, fmt.Errorf("multiple clusters configured, a cluster must be specified")
+		}
+		return archivistCfg.Clusters[0], nil
+	}
+	for _, cc := range archivistCfg.Clusters {
+		if cc.Name == name {
+			return cc, nil
+		}
+	}
+	return config.ClusterConfig{}, fmt.Errorf("no such cluster: %s", name)
 }
@@ -0,0 +1,91 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/openshift/online/archivist/pkg/clustermonitor"
+)
+
+// clusterHealth is the state of the monitor for a single cluster.
+type clusterHealth struct {
+	// monitor is the running monitor, nil if it is not running.
+	monitor *clustermonitor.ClusterMonitor
+}
+
+// healthChecker serves the liveness and readiness checks for every configured cluster.
+type healthChecker struct {
+	mutex    sync.Mutex
+	clusters map[string]*clusterHealth
+}
+
+func newHealthChecker(clusterNames []string) *healthChecker {
+	h := &healthChecker{clusters: map[string]*clusterHealth{}}
+	for _, name := range clusterNames {
+		h.clusters[name] = &clusterHealth{}
+	}
+	return h
+}
+
+// setMonitor records the monitor now running for a cluster.
+func (h *healthChecker) setMonitor(cluster string, monitor *clustermonitor.ClusterMonitor) {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+	h.clusters[cluster] = &clusterHealth{monitor: monitor}
+}
+
+// live returns the problems with running monitors whose capacity checks have stalled. Clusters whose monitor
+// is not running are not considered, they are retried without restarting the archivist.
+func (h *healthChecker) live() []string {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+	now := time.Now()
+	problems := []string{}
+	for name, ch := range h.clusters {
+		if ch.monitor == nil {
+			continue
+		}
+		if err := ch.monitor.Healthy(now); err != nil {
+			problems = append(problems, fmt.Sprintf("cluster %s: %s", name, err))
+		}
+	}
+	return problems
+}
+
+// ready returns the problems with clusters whose monitor has not started, or whose informers have not synced.
+func (h *healthChecker) ready() []string {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+	problems := []string{}
+	for name, ch := range h.clusters {
+		switch {
+		case ch.monitor == nil:
+			problems = append(problems, fmt.Sprintf("cluster %s: monitor not started", name))
+		case !ch.monitor.HasSynced():
+			problems = append(problems, fmt.Sprintf("cluster %s: informers not synced", name))
+		}
+	}
+	return problems
+}
+
+func (h *healthChecker) handleHealthz(w http.ResponseWriter, r *http.Request) {
+	writeCheckResult(w, h.live())
+}
+
+func (h *healthChecker) handleReadyz(w http.ResponseWriter, r *http.Request) {
+	writeCheckResult(w, h.ready())
+}
+
+func writeCheckResult(w http.ResponseWriter, problems []string) {
+	if len(problems) == 0 {
+		fmt.Fprintln(w, "ok")
+		return
+	}
+	sort.Strings(problems)
+	w.WriteHeader(http.StatusInternalServerError)
+	fmt.Fprintln(w, strings.Join(problems, "\n"))
+}
@@ -0,0 +1,22 @@
+package main
+
+import (
+	"net/http"
+
+	"github.com/prometheus/client_golang/prometheus"
+
+	log "github.com/Sirupsen/logrus"
+)
+
+// startHTTPServer serves Prometheus metrics at /metrics, and the liveness and readiness checks at /healthz and
+// /readyz, on the given address. A failure to listen is fatal, as the archivist would otherwise run unmonitored.
+func startHTTPServer(addr string, health *healthChecker) {
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", prometheus.Handler())
+	mux.HandleFunc("/healthz", health.handleHealthz)
+	mux.HandleFunc("/readyz", health.handleReadyz)
+	go func() {
+		log.WithFields(log.Fields{"address": addr}).Infoln("starting HTTP server")
+		log.Fatal(http.ListenAndServe(addr, mux))
+	}()
+}
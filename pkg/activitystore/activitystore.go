@@ -0,0 +1,178 @@
+// Package activitystore persists the last activity found in each namespace, so it is not lost when the objects it
+// was found from are pruned or garbage collected, or when the archivist restarts.
+//
+// Activity is held in memory and written to a BoltDB file in batches, as informers report far more updates than
+// it would be reasonable to write individually. Stored activity only ever moves forward.
+package activitystore
+
+import (
+	"encoding/json"
+	"fmt"
+	"sync"
+	"time"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/boltdb/bolt"
+)
+
+const logComponent = "activitystore"
+
+// openTimeout is how long to wait for another process to release its lock on the store.
+const openTimeout = 10 * time.Second
+
+// Record is the most recent activity found in a namespace by one activity source.
+type Record struct {
+	Time time.Time `json:"time"`
+	// Kind and Name identify the object responsible for the activity:
+	Kind string `json:"kind,omitempty"`
+	Name string `json:"name,omitempty"`
+}
+
+// Store is a file holding the activity of every managed cluster, one bucket per cluster.
+type Store struct {
+	db *bolt.DB
+}
+
+// Open opens the store at path, creating it if it does not exist.
+func Open(path string) (*Store, error) {
+	db, err := bolt.Open(path, 0600, &bolt.Options{Timeout: openTimeout})
+	if err != nil {
+		return nil, fmt.Errorf("error opening activity store %s: %s", path, err)
+	}
+	return &Store{db: db}, nil
+}
+
+// Close closes the store. Cluster stores should be flushed first.
+func (s *Store) Close() error {
+	return s.db.Close()
+}
+
+// Cluster loads the activity stored for the named cluster.
+func (s *Store) Cluster(name string) (*ClusterStore, error) {
+	cs := &ClusterStore{
+		db:      s.db,
+		bucket:  []byte(name),
+		records: map[string]map[string]Record{},
+		dirty:   map[string]bool{},
+		log:     log.WithFields(log.Fields{"component": logComponent, "cluster": name}),
+	}
+	err := s.db.Update(func(tx *bolt.Tx) error {
+		b, err := tx.CreateBucketIfNotExists(cs.bucket)
+		if err != nil {
+			return err
+		}
+		return b.ForEach(func(k, v []byte) error {
+			records := map[string]Record{}
+			if err := json.Unmarshal(v, &records); err != nil {
+				return fmt.Errorf("invalid activity for namespace %s: %s", k, err)
+			}
+			cs.records[string(k)] = records
+			return nil
+		})
+	})
+	if err != nil {
+		return nil, fmt.Errorf("error loading activity for cluster %s: %s", name, err)
+	}
+	return cs, nil
+}
+
+// ClusterStore holds the activity found by each source in each namespace of a cluster. It is safe for concurrent
+// use.
+type ClusterStore struct {
+	db     *bolt.DB
+	bucket []byte
+	log    *log.Entry
+
+	mutex sync.Mutex
+	// records holds the activity in each namespace by source:
+	records map[string]map[string]Record
+	// dirty holds the namespaces changed since the last flush, including those deleted:
+	dirty map[string]bool
+}
+
+// Record stores activity found by a source in a namespace, unless the source has already found more recent
+// activity there.
+func (s *ClusterStore) Record(namespace, source string, record Record) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	records, ok := s.records[namespace]
+	if !ok {
+		records = map[string]Record{}
+		s.records[namespace] = records
+	}
+	if !record.Time.After(records[source].Time) {
+		return
+	}
+	records[source] = record
+	s.dirty[namespace] = true
+}
+
+// Get returns the activity stored for a source in a namespace, with a zero time if there is none.
+func (s *ClusterStore) Get(namespace, source string) Record {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return s.records[namespace][source]
+}
+
+// Delete removes the activity stored for a namespace, when the namespace itself is deleted.
+func (s *ClusterStore) Delete(namespace string) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if _, ok := s.records[namespace]; !ok {
+		return
+	}
+	delete(s.records, namespace)
+	s.dirty[namespace] = true
+}
+
+// Flush writes all changes since the last flush to disk in a single transaction.
+func (s *ClusterStore) Flush() error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if len(s.dirty) == 0 {
+		return nil
+	}
+	err := s.db.Update(func(tx *bolt.Tx) error {
+		b := tx.Bucket(s.bucket)
+		for namespace := range s.dirty {
+			records, ok := s.records[namespace]
+			if !ok {
+				if err := b.Delete([]byte(namespace)); err != nil {
+					return err
+				}
+				continue
+			}
+			data, err := json.Marshal(records)
+			if err != nil {
+				return err
+			}
+			if err := b.Put([]byte(namespace), data); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("error writing activity store: %s", err)
+	}
+	s.log.WithFields(log.Fields{"namespaces": len(s.dirty)}).Debugln("flushed activity store")
+	s.dirty = map[string]bool{}
+	return nil
+}
+
+// Run flushes the store every interval until stopChan is closed, and then once more.
+func (s *ClusterStore) Run(interval time.Duration, stopChan <-chan struct{}) {
+	for {
+		select {
+		case <-stopChan:
+			if err := s.Flush(); err != nil {
+				s.log.Errorln(err)
+			}
+			return
+		case <-time.After(interval):
+			if err := s.Flush(); err != nil {
+				s.log.Errorln(err)
+			}
+		}
+	}
+}
@@ -0,0 +1,69 @@
+package activitystore
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func tm(year int, month time.Month, day int) time.Time {
+	return time.Date(year, month, day, 0, 0, 0, 0, time.UTC)
+}
+
+func TestClusterStore(t *testing.T) {
+	dir, err := ioutil.TempDir("", "activitystore")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "activity.db")
+
+	store, err := Open(path)
+	if !assert.Nil(t, err) {
+		return
+	}
+	cs, err := store.Cluster("cluster1")
+	if !assert.Nil(t, err) {
+		return
+	}
+	cs.Record("ns1", "builds", Record{Time: tm(2017, time.March, 1), Kind: "Build", Name: "build2"})
+	// Activity only moves forward:
+	cs.Record("ns1", "builds", Record{Time: tm(2017, time.February, 1), Kind: "Build", Name: "build1"})
+	cs.Record("ns1", "pods", Record{Time: tm(2017, time.January, 1), Kind: "Pod", Name: "pod1"})
+	cs.Record("ns2", "builds", Record{Time: tm(2017, time.April, 1), Kind: "Build", Name: "build1"})
+	cs.Record("ns3", "builds", Record{Time: tm(2017, time.April, 1), Kind: "Build", Name: "build1"})
+	assert.Equal(t, Record{Time: tm(2017, time.March, 1), Kind: "Build", Name: "build2"}, cs.Get("ns1", "builds"))
+	assert.Nil(t, cs.Flush())
+
+	// Changes after a flush:
+	cs.Delete("ns2")
+	cs.Record("ns3", "builds", Record{Time: tm(2017, time.May, 1), Kind: "Build", Name: "build2"})
+	// Activity in other clusters is kept separately:
+	other, err := store.Cluster("cluster2")
+	if !assert.Nil(t, err) {
+		return
+	}
+	other.Record("ns1", "builds", Record{Time: tm(2017, time.May, 1)})
+	assert.Nil(t, cs.Flush())
+	assert.Nil(t, other.Flush())
+	assert.Nil(t, store.Close())
+
+	store, err = Open(path)
+	if !assert.Nil(t, err) {
+		return
+	}
+	defer store.Close()
+	cs, err = store.Cluster("cluster1")
+	if !assert.Nil(t, err) {
+		return
+	}
+	assert.Equal(t, Record{Time: tm(2017, time.March, 1), Kind: "Build", Name: "build2"}, cs.Get("ns1", "builds"))
+	assert.Equal(t, Record{Time: tm(2017, time.January, 1), Kind: "Pod", Name: "pod1"}, cs.Get("ns1", "pods"))
+	assert.Equal(t, Record{}, cs.Get("ns2", "builds"))
+	assert.Equal(t, Record{Time: tm(2017, time.May, 1), Kind: "Build", Name: "build2"}, cs.Get("ns3", "builds"))
+	assert.Equal(t, Record{}, cs.Get("ns4", "builds"))
+}
@@ -0,0 +1,239 @@
+package archive
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"time"
+)
+
+// FormatVersion is the version of the archive format written by this package.
+const FormatVersion = 1
+
+// ManifestPath is the path of the manifest within the archive.
+const ManifestPath = "manifest.json"
+
+// Manifest describes an archive and every object it contains.
+type Manifest struct {
+	// FormatVersion is the version of the archive format.
+	FormatVersion int `json:"formatVersion"`
+	// ClusterName is the name of the cluster the namespace was archived from, as configured for the archivist.
+	ClusterName string `json:"clusterName"`
+	// Namespace is the name of the archived namespace.
+	Namespace string `json:"namespace"`
+	// LastActivity is the last activity time calculated for the namespace when it was selected for archival.
+	LastActivity time.Time `json:"lastActivity"`
+	// ArchivedAt is the time the archive was written.
+	ArchivedAt time.Time `json:"archivedAt"`
+	// ArchivistVersion is the version of the archivist which wrote the archive.
+	ArchivistVersion string `json:"archivistVersion"`
+	// ObjectCounts is the number of objects in the archive of each kind.
+	ObjectCounts map[string]int `json:"objectCounts"`
+	// Objects lists every object in the archive, in the order they were written.
+	Objects []ObjectEntry `json:"objects"`
+}
+
+// ObjectEntry describes a single API object in an archive.
+type ObjectEntry struct {
+	// Path is the path of the file holding the object within the archive.
+	Path       string `json:"path"`
+	Kind       string `json:"kind"`
+	APIVersion string `json:"apiVersion"`
+	Name       string `json:"name"`
+	// Size is the size of the file in bytes.
+	Size int64 `json:"size"`
+	// SHA256 is the hex encoded SHA-256 digest of the file.
+	SHA256 string `json:"sha256"`
+}
+
+// Archive is the content of an archive which has been read and verified against its manifest.
+type Archive struct {
+	Manifest Manifest
+	// Objects holds the serialized API objects, keyed by path.
+	Objects map[string][]byte
+}
+
+// objectHeader holds the fields needed from every serialized object.
+type objectHeader struct {
+	Kind       string `json:"kind"`
+	APIVersion string `json:"apiVersion"`
+	Metadata   struct {
+		Name string `json:"name"`
+	} `json:"metadata"`
+}
+
+// Writer writes an archive. Objects are held in memory until Close, as the manifest must be written first.
+type Writer struct {
+	w        io.Writer
+	manifest Manifest
+	objects  [][]byte
+}
+
+// NewWriter returns a Writer which will write an archive to w. The cluster name, namespace, last activity and
+// archivist version are taken from the given manifest, the remaining fields are populated as objects are added.
+func NewWriter(w io.Writer, manifest Manifest) *Writer {
+	manifest.FormatVersion = FormatVersion
+	manifest.ObjectCounts = map[string]int{}
+	manifest.Objects = []ObjectEntry{}
+	return &Writer{w: w, manifest: manifest}
+}
+
+// AddObject adds a JSON serialized API object to the archive. The object must include its kind and API version.
+func (w *Writer) AddObject(data []byte) error {
+	var hdr objectHeader
+	if err := json.Unmarshal(data, &hdr); err != nil {
+		return fmt.Errorf("unable to decode object: %s", err)
+	}
+	if hdr.Kind == "" || hdr.APIVersion == "" || hdr.Metadata.Name == "" {
+		return fmt.Errorf("object must have a kind, apiVersion and name")
+	}
+	path := fmt.Sprintf("%s/%s.json", hdr.Kind, hdr.Metadata.Name)
+	for _, e := range w.manifest.Objects {
+		if e.Path == path {
+			return fmt.Errorf("duplicate object in archive: %s", path)
+		}
+	}
+	sum := sha256.Sum256(data)
+	w.manifest.Objects = append(w.manifest.Objects, ObjectEntry{
+		Path:       path,
+		Kind:       hdr.Kind,
+		APIVersion: hdr.APIVersion,
+		Name:       hdr.Metadata.Name,
+		Size:       int64(len(data)),
+		SHA256:     hex.EncodeToString(sum[:]),
+	})
+	w.manifest.ObjectCounts[hdr.Kind]++
+	w.objects = append(w.objects, data)
+	return nil
+}
+
+// Manifest returns the manifest as it will be written.
+func (w *Writer) Manifest() Manifest {
+	return w.manifest
+}
+
+// Close writes the manifest and all objects, then flushes the tarball and gzip streams. It does not close the
+// underlying writer.
+func (w *Writer) Close() error {
+	if w.manifest.ArchivedAt.IsZero() {
+		w.manifest.ArchivedAt = time.Now().UTC()
+	}
+	manifestData, err := json.MarshalIndent(w.manifest, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	gz := gzip.NewWriter(w.w)
+	tw := tar.NewWriter(gz)
+	if err := addFile(tw, ManifestPath, manifestData, w.manifest.ArchivedAt); err != nil {
+		return err
+	}
+	for i, e := range w.manifest.Objects {
+		if err := addFile(tw, e.Path, w.objects[i], w.manifest.ArchivedAt); err != nil {
+			return err
+		}
+	}
+	if err := tw.Close(); err != nil {
+		return err
+	}
+	return gz.Close()
+}
+
+func addFile(tw *tar.Writer, name string, data []byte, modTime time.Time) error {
+	hdr := &tar.Header{
+		Name:    name,
+		Mode:    0644,
+		Size:    int64(len(data)),
+		ModTime: modTime,
+	}
+	if err := tw.WriteHeader(hdr); err != nil {
+		return err
+	}
+	_, err := tw.Write(data)
+	return err
+}
+
+// Read reads an archive and verifies every object against the manifest.
+func Read(r io.Reader) (*Archive, error) {
+	gz, err := gzip.NewReader(r)
+	if err != nil {
+		return nil, err
+	}
+	defer gz.Close()
+	tr := tar.NewReader(gz)
+
+	hdr, err := tr.Next()
+	if err != nil {
+		return nil, fmt.Errorf("error reading manifest: %s", err)
+	}
+	if hdr.Name != ManifestPath {
+		return nil, fmt.Errorf("archive does not begin with a manifest, found %s", hdr.Name)
+	}
+	a := &Archive{Objects: map[string][]byte{}}
+	if err := json.NewDecoder(tr).Decode(&a.Manifest); err != nil {
+		return nil, fmt.Errorf("error decoding manifest: %s", err)
+	}
+	if a.Manifest.FormatVersion < 1 || a.Manifest.FormatVersion > FormatVersion {
+		return nil, fmt.Errorf("unsupported archive format version %d", a.Manifest.FormatVersion)
+	}
+
+	entries := map[string]ObjectEntry{}
+	for _, e := range a.Manifest.Objects {
+		entries[e.Path] = e
+	}
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		e, ok := entries[hdr.Name]
+		if !ok {
+			return nil, fmt.Errorf("archive contains %s which is not in the manifest", hdr.Name)
+		}
+		if _, exists := a.Objects[hdr.Name]; exists {
+			return nil, fmt.Errorf("duplicate file in archive: %s", hdr.Name)
+		}
+		data, err := ioutil.ReadAll(tr)
+		if err != nil {
+			return nil, err
+		}
+		sum := sha256.Sum256(data)
+		if hex.EncodeToString(sum[:]) != e.SHA256 {
+			return nil, fmt.Errorf("digest mismatch for %s", hdr.Name)
+		}
+		a.Objects[hdr.Name] = data
+	}
+	if err := a.verifyManifest(); err != nil {
+		return nil, err
+	}
+	return a, nil
+}
+
+// verifyManifest checks every object in the manifest was read and the object counts are consistent.
+func (a *Archive) verifyManifest() error {
+	counts := map[string]int{}
+	for _, e := range a.Manifest.Objects {
+		if _, ok := a.Objects[e.Path]; !ok {
+			return fmt.Errorf("archive is missing %s", e.Path)
+		}
+		counts[e.Kind]++
+	}
+	for kind, count := range a.Manifest.ObjectCounts {
+		if counts[kind] != count {
+			return fmt.Errorf("manifest records %d objects of kind %s, found %d", count, kind, counts[kind])
+		}
+		delete(counts, kind)
+	}
+	for kind := range counts {
+		return fmt.Errorf("manifest has no object count for kind %s", kind)
+	}
+	return nil
+}
@@ -0,0 +1,184 @@
+package archive
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"io"
+	"io/ioutil"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+var testObjects = [][]byte{
+	[]byte(`{"kind":"Namespace","apiVersion":"v1","metadata":{"name":"myproject"}}`),
+	[]byte(`{"kind":"Secret","apiVersion":"v1","metadata":{"name":"builder-token"}}`),
+	[]byte(`{"kind":"Secret","apiVersion":"v1","metadata":{"name":"mysecret"}}`),
+	[]byte(`{"kind":"Route","apiVersion":"v1","metadata":{"name":"frontend"},"spec":{"host":"example.com"}}`),
+}
+
+func writeTestArchive(t *testing.T, objects [][]byte) *bytes.Buffer {
+	var buf bytes.Buffer
+	w := NewWriter(&buf, Manifest{
+		ClusterName:      "test cluster",
+		Namespace:        "myproject",
+		LastActivity:     time.Date(2017, time.January, 1, 0, 0, 0, 0, time.UTC),
+		ArchivistVersion: "v0.1",
+	})
+	for _, data := range objects {
+		if err := w.AddObject(data); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return &buf
+}
+
+// rewriteArchive writes an archive containing the given files, in order, without any validation.
+func rewriteArchive(t *testing.T, names []string, files map[string][]byte) *bytes.Buffer {
+	var buf bytes.Buffer
+	gz := gzip.NewWriter(&buf)
+	tw := tar.NewWriter(gz)
+	for _, name := range names {
+		if err := addFile(tw, name, files[name], time.Now()); err != nil {
+			t.Fatal(err)
+		}
+	}
+	tw.Close()
+	gz.Close()
+	return &buf
+}
+
+func TestArchiveRoundTrip(t *testing.T) {
+	a, err := Read(writeTestArchive(t, testObjects))
+	if !assert.Nil(t, err) {
+		return
+	}
+	m := a.Manifest
+	assert.Equal(t, FormatVersion, m.FormatVersion)
+	assert.Equal(t, "test cluster", m.ClusterName)
+	assert.Equal(t, "myproject", m.Namespace)
+	assert.Equal(t, time.Date(2017, time.January, 1, 0, 0, 0, 0, time.UTC), m.LastActivity)
+	assert.Equal(t, "v0.1", m.ArchivistVersion)
+	assert.False(t, m.ArchivedAt.IsZero())
+	assert.Equal(t, map[string]int{"Namespace": 1, "Secret": 2, "Route": 1}, m.ObjectCounts)
+
+	if assert.Equal(t, len(testObjects), len(m.Objects)) {
+		assert.Equal(t, "Route/frontend.json", m.Objects[3].Path)
+		assert.Equal(t, "Route", m.Objects[3].Kind)
+		assert.Equal(t, "v1", m.Objects[3].APIVersion)
+		assert.Equal(t, "frontend", m.Objects[3].Name)
+		for i, e := range m.Objects {
+			assert.Equal(t, testObjects[i], a.Objects[e.Path])
+		}
+	}
+}
+
+func TestAddInvalidObjects(t *testing.T) {
+	w := NewWriter(&bytes.Buffer{}, Manifest{})
+	assert.NotNil(t, w.AddObject([]byte("not json")))
+	assert.NotNil(t, w.AddObject([]byte(`{"apiVersion":"v1","metadata":{"name":"nokind"}}`)))
+	assert.Nil(t, w.AddObject(testObjects[0]))
+	assert.NotNil(t, w.AddObject(testObjects[0]))
+}
+
+// rawFiles returns the files in an archive without any validation, along with the object paths in order.
+func rawFiles(t *testing.T, buf *bytes.Buffer) ([]string, map[string][]byte) {
+	gz, err := gzip.NewReader(buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tr := tar.NewReader(gz)
+	var names []string
+	files := map[string][]byte{}
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		data, err := ioutil.ReadAll(tr)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if hdr.Name != ManifestPath {
+			names = append(names, hdr.Name)
+		}
+		files[hdr.Name] = data
+	}
+	return names, files
+}
+
+func TestReadInvalidArchives(t *testing.T) {
+	names, files := rawFiles(t, writeTestArchive(t, testObjects))
+
+	tests := []struct {
+		name                string
+		names               []string
+		modify              func(files map[string][]byte)
+		expectedErrContains string
+	}{
+		{
+			name:                "manifest not first",
+			names:               append(append([]string{}, names...), ManifestPath),
+			expectedErrContains: "does not begin with a manifest",
+		},
+		{
+			name:                "missing object",
+			names:               append([]string{ManifestPath}, names[1:]...),
+			expectedErrContains: "archive is missing",
+		},
+		{
+			name:  "tampered object",
+			names: append([]string{ManifestPath}, names...),
+			modify: func(files map[string][]byte) {
+				files["Route/frontend.json"] = []byte(`{"kind":"Route","apiVersion":"v1","metadata":{"name":"evil"}}`)
+			},
+			expectedErrContains: "digest mismatch",
+		},
+		{
+			name:  "unexpected object",
+			names: append([]string{ManifestPath, "Secret/extra.json"}, names...),
+			modify: func(files map[string][]byte) {
+				files["Secret/extra.json"] = []byte(`{}`)
+			},
+			expectedErrContains: "not in the manifest",
+		},
+		{
+			name:  "newer format version",
+			names: append([]string{ManifestPath}, names...),
+			modify: func(files map[string][]byte) {
+				files[ManifestPath] = bytes.Replace(files[ManifestPath], []byte(`"formatVersion": 1`),
+					[]byte(`"formatVersion": 99`), 1)
+			},
+			expectedErrContains: "unsupported archive format version 99",
+		},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			tcFiles := map[string][]byte{}
+			for k, v := range files {
+				tcFiles[k] = v
+			}
+			if tc.modify != nil {
+				tc.modify(tcFiles)
+			}
+			_, err := Read(rewriteArchive(t, tc.names, tcFiles))
+			if assert.NotNil(t, err) {
+				assert.True(t, strings.Contains(err.Error(), tc.expectedErrContains), err.Error())
+			}
+		})
+	}
+}
+
+func TestReadNotAnArchive(t *testing.T) {
+	_, err := Read(bytes.NewBufferString("not an archive"))
+	assert.NotNil(t, err)
+}
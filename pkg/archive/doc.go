@@ -0,0 +1,13 @@
+// Package archive reads and writes namespace archives.
+//
+// An archive is a gzipped tarball. The first file is always manifest.json, a JSON encoded Manifest describing
+// the archive. Every other file holds a single JSON encoded API object at the path
+// "<Kind>/<name>.json", e.g. "Service/frontend.json". Each object is recorded in the manifest along with its
+// API version and the SHA-256 digest of its file, readers must reject archives where any file is missing,
+// unexpected, or does not match its digest.
+//
+// The manifest records the FormatVersion the archive was written with. Changes to the format which older
+// readers would not handle correctly must increment FormatVersion, and readers refuse archives with a newer
+// format version than they understand. Fields may be added to the manifest without incrementing the version,
+// but never removed or repurposed, so archives written years apart remain readable.
+package archive
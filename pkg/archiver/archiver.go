@@ -0,0 +1,209 @@
+package archiver
+
+import (
+	"bytes"
+	"fmt"
+	"time"
+
+	"github.com/openshift/online/archivist/pkg/archive"
+	"github.com/openshift/online/archivist/pkg/archivestore"
+	"github.com/openshift/online/archivist/pkg/config"
+	"github.com/openshift/online/archivist/pkg/metrics"
+	"github.com/openshift/online/archivist/pkg/version"
+
+	oclient "github.com/openshift/origin/pkg/client"
+
+	// Register all OpenShift API groups so their objects can be encoded and decoded:
+	_ "github.com/openshift/origin/pkg/api/install"
+
+	kapi "k8s.io/kubernetes/pkg/api"
+	_ "k8s.io/kubernetes/pkg/api/install"
+	"k8s.io/kubernetes/pkg/api/meta"
+	"k8s.io/kubernetes/pkg/apimachinery/registered"
+	kclientset "k8s.io/kubernetes/pkg/client/clientset_generated/internalclientset"
+	"k8s.io/kubernetes/pkg/runtime"
+
+	log "github.com/Sirupsen/logrus"
+)
+
+const logComponent = "archiver"
+
+// Archiver exports all API objects in a namespace to an archive, verifies the archive, and then
+// deletes the namespace from the cluster.
+type Archiver struct {
+	clusterCfg config.ClusterConfig
+	store      archivestore.ArchiveStore
+	oc         oclient.Interface
+	kc         kclientset.Interface
+	codec      runtime.Codec
+}
+
+func NewArchiver(clusterConfig config.ClusterConfig, store archivestore.ArchiveStore,
+	oc oclient.Interface, kc kclientset.Interface) *Archiver {
+
+	return &Archiver{
+		clusterCfg: clusterConfig,
+		store:      store,
+		oc:         oc,
+		kc:         kc,
+		codec:      kapi.Codecs.LegacyCodec(registered.EnabledVersions()...),
+	}
+}
+
+// exportedObject is a single serialized API object destined for the archive.
+type exportedObject struct {
+	kind string
+	name string
+	data []byte
+}
+
+// Archive exports the namespace to an archive, verifies the archive can be read back and contains every
+// exported object, and only then deletes the namespace. If any step before the deletion fails the namespace
+// is left untouched. Namespaces containing objects which archives cannot hold, or bound persistent volume claims,
+// are refused.
+func (a *Archiver) Archive(namespace *kapi.Namespace, lastActivity time.Time) (err error) {
+	defer func() { metrics.RecordArchive(a.clusterCfg.Name, err) }()
+	nsLog := log.WithFields(log.Fields{
+		"namespace":    namespace.Name,
+		"cluster":      a.clusterCfg.Name,
+		"lastActivity": lastActivity,
+		"component":    logComponent,
+	})
+	nsLog.Infoln("archiving namespace")
+
+	if err := a.checkArchivable(namespace.Name); err != nil {
+		return fmt.Errorf("refusing to archive namespace %s: %s", namespace.Name, err)
+	}
+
+	objects, err := a.export(namespace.Name)
+	if err != nil {
+		return fmt.Errorf("error exporting namespace %s: %s", namespace.Name, err)
+	}
+	nsLog.WithFields(log.Fields{"objects": len(objects)}).Debugln("exported namespace objects")
+
+	var buf bytes.Buffer
+	w := archive.NewWriter(&buf, archive.Manifest{
+		ClusterName:      a.clusterCfg.Name,
+		Namespace:        namespace.Name,
+		LastActivity:     lastActivity,
+		ArchivistVersion: version.Version,
+	})
+	for _, o := range objects {
+		if err := w.AddObject(o.data); err != nil {
+			return fmt.Errorf("error adding %s %s to archive: %s", o.kind, o.name, err)
+		}
+	}
+	if err := w.Close(); err != nil {
+		return fmt.Errorf("error writing archive for namespace %s: %s", namespace.Name, err)
+	}
+
+	key := archivestore.Key{Cluster: a.clusterCfg.Name, Namespace: namespace.Name}
+	if err := a.store.Put(key, &buf); err != nil {
+		return fmt.Errorf("error storing archive %s: %s", key, err)
+	}
+
+	if err := a.verify(key, w.Manifest()); err != nil {
+		return fmt.Errorf("error verifying archive %s: %s", key, err)
+	}
+	nsLog.WithFields(log.Fields{"archive": key.String()}).Infoln("archive verified")
+
+	if err := a.kc.Core().Namespaces().Delete(namespace.Name, &kapi.DeleteOptions{}); err != nil {
+		return fmt.Errorf("error deleting archived namespace %s: %s", namespace.Name, err)
+	}
+	nsLog.Infoln("namespace archived and deleted")
+	return nil
+}
+
+// checkArchivable returns an error if the namespace contains anything which would be lost if it were archived and
+// deleted. Refusals are counted by the kind of object responsible.
+func (a *Archiver) checkArchivable(namespace string) error {
+	for _, res := range unarchivableResources(a.oc, a.kc) {
+		list, err := res.list(namespace)
+		if err != nil {
+			return fmt.Errorf("error listing %s: %s", res.kind, err)
+		}
+		items, err := meta.ExtractList(list)
+		if err != nil {
+			return fmt.Errorf("error extracting %s list: %s", res.kind, err)
+		}
+		for _, item := range items {
+			if res.blocks != nil && !res.blocks(item) {
+				continue
+			}
+			accessor, err := meta.Accessor(item)
+			if err != nil {
+				return err
+			}
+			metrics.RecordArchiveRefused(a.clusterCfg.Name, res.kind)
+			return fmt.Errorf("%s %s cannot be archived", res.kind, accessor.GetName())
+		}
+	}
+	return nil
+}
+
+// export lists and serializes the namespace itself and every exported resource within it.
+func (a *Archiver) export(namespace string) ([]exportedObject, error) {
+	ns, err := a.kc.Core().Namespaces().Get(namespace)
+	if err != nil {
+		return nil, err
+	}
+	data, err := runtime.Encode(a.codec, ns)
+	if err != nil {
+		return nil, err
+	}
+	objects := []exportedObject{{kind: "Namespace", name: ns.Name, data: data}}
+
+	for _, res := range namespacedResources(a.oc, a.kc) {
+		list, err := res.list(namespace)
+		if err != nil {
+			return nil, fmt.Errorf("error listing %s: %s", res.kind, err)
+		}
+		items, err := meta.ExtractList(list)
+		if err != nil {
+			return nil, fmt.Errorf("error extracting %s list: %s", res.kind, err)
+		}
+		for _, item := range items {
+			accessor, err := meta.Accessor(item)
+			if err != nil {
+				return nil, err
+			}
+			data, err := runtime.Encode(a.codec, item)
+			if err != nil {
+				return nil, fmt.Errorf("error encoding %s %s: %s", res.kind, accessor.GetName(), err)
+			}
+			objects = append(objects, exportedObject{kind: res.kind, name: accessor.GetName(), data: data})
+		}
+	}
+	return objects, nil
+}
+
+// verify re-reads the archive from the store, which checks every object against the digests in its manifest,
+// then checks the manifest matches the one written and that every object decodes to a valid API object.
+func (a *Archiver) verify(key archivestore.Key, written archive.Manifest) error {
+	r, err := a.store.Get(key)
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+
+	stored, err := archive.Read(r)
+	if err != nil {
+		return err
+	}
+	m := stored.Manifest
+	if m.ClusterName != written.ClusterName || m.Namespace != written.Namespace {
+		return fmt.Errorf("archive is for namespace %s/%s", m.ClusterName, m.Namespace)
+	}
+	if len(m.Objects) != len(written.Objects) {
+		return fmt.Errorf("archive contains %d objects, expected %d", len(m.Objects), len(written.Objects))
+	}
+	for i, e := range written.Objects {
+		if m.Objects[i] != e {
+			return fmt.Errorf("archive manifest does not match for %s", e.Path)
+		}
+		if _, err := runtime.Decode(kapi.Codecs.UniversalDecoder(), stored.Objects[e.Path]); err != nil {
+			return fmt.Errorf("unable to decode %s: %s", e.Path, err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,169 @@
+package archiver
+
+import (
+	"io/ioutil"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/openshift/online/archivist/pkg/archive"
+	"github.com/openshift/online/archivist/pkg/archivestore"
+	"github.com/openshift/online/archivist/pkg/config"
+
+	otestclient "github.com/openshift/origin/pkg/client/testclient"
+	routeapi "github.com/openshift/origin/pkg/route/api"
+
+	kapi "k8s.io/kubernetes/pkg/api"
+	"k8s.io/kubernetes/pkg/apis/apps"
+	ktestclient "k8s.io/kubernetes/pkg/client/clientset_generated/internalclientset/fake"
+	ktestcore "k8s.io/kubernetes/pkg/client/testing/core"
+	"k8s.io/kubernetes/pkg/runtime"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+)
+
+func init() {
+	log.SetLevel(log.DebugLevel)
+}
+
+func fakeNamespace(name string) *kapi.Namespace {
+	return &kapi.Namespace{ObjectMeta: kapi.ObjectMeta{Name: name}}
+}
+
+func fakeSecret(namespace, name string) *kapi.Secret {
+	return &kapi.Secret{ObjectMeta: kapi.ObjectMeta{Name: name, Namespace: namespace}}
+}
+
+func fakeRoute(namespace, name string) *routeapi.Route {
+	return &routeapi.Route{ObjectMeta: kapi.ObjectMeta{Name: name, Namespace: namespace}}
+}
+
+func hasDeleteNamespaceAction(kc *ktestclient.Clientset, name string) bool {
+	for _, action := range kc.Actions() {
+		deleteAction, ok := action.(ktestcore.DeleteAction)
+		if ok && deleteAction.GetResource().Resource == "namespaces" && deleteAction.GetName() == name {
+			return true
+		}
+	}
+	return false
+}
+
+func newTestArchiver(t *testing.T, kc *ktestclient.Clientset, oc *otestclient.Fake) (*Archiver, string) {
+	dir, err := ioutil.TempDir("", "archiver")
+	if err != nil {
+		t.Fatal(err)
+	}
+	store, err := archivestore.NewFilesystemStore(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	aConfig := config.NewDefaultArchivistConfig()
+	return NewArchiver(aConfig.Clusters[0], store, oc, kc), dir
+}
+
+func TestArchive(t *testing.T) {
+	kc := ktestclient.NewSimpleClientset(
+		fakeNamespace("myproject"),
+		fakeSecret("myproject", "secret1"),
+		fakeSecret("myproject", "secret2"),
+	)
+	oc := otestclient.NewSimpleFake(fakeRoute("myproject", "frontend"))
+	a, dir := newTestArchiver(t, kc, oc)
+	defer os.RemoveAll(dir)
+
+	err := a.Archive(fakeNamespace("myproject"), time.Date(2017, time.January, 1, 0, 0, 0, 0, time.UTC))
+	if !assert.Nil(t, err) {
+		return
+	}
+
+	r, err := a.store.Get(archivestore.Key{Cluster: "local cluster", Namespace: "myproject"})
+	if !assert.Nil(t, err) {
+		return
+	}
+	defer r.Close()
+	stored, err := archive.Read(r)
+	if assert.Nil(t, err) {
+		for _, path := range []string{
+			"Namespace/myproject.json",
+			"Secret/secret1.json",
+			"Secret/secret2.json",
+			"Route/frontend.json",
+		} {
+			_, ok := stored.Objects[path]
+			assert.True(t, ok, "archive is missing %s", path)
+		}
+		assert.Equal(t, "local cluster", stored.Manifest.ClusterName)
+		assert.Equal(t, "myproject", stored.Manifest.Namespace)
+		assert.Equal(t, time.Date(2017, time.January, 1, 0, 0, 0, 0, time.UTC), stored.Manifest.LastActivity)
+		assert.Equal(t, 2, stored.Manifest.ObjectCounts["Secret"])
+	}
+	assert.True(t, hasDeleteNamespaceAction(kc, "myproject"))
+}
+
+func TestArchiveMissingNamespace(t *testing.T) {
+	kc := ktestclient.NewSimpleClientset()
+	oc := otestclient.NewSimpleFake()
+	a, dir := newTestArchiver(t, kc, oc)
+	defer os.RemoveAll(dir)
+
+	err := a.Archive(fakeNamespace("myproject"), time.Date(2017, time.January, 1, 0, 0, 0, 0, time.UTC))
+	assert.NotNil(t, err)
+	// Nothing should ever be deleted if the export failed:
+	assert.False(t, hasDeleteNamespaceAction(kc, "myproject"))
+}
+
+func TestArchiveRefused(t *testing.T) {
+	controller := true
+	tests := []struct {
+		name    string
+		objects []runtime.Object
+		refused bool
+	}{
+		{
+			name:    "stateful set",
+			objects: []runtime.Object{&apps.StatefulSet{ObjectMeta: kapi.ObjectMeta{Name: "db", Namespace: "myproject"}}},
+			refused: true,
+		},
+		{
+			name: "bound persistent volume claim",
+			objects: []runtime.Object{&kapi.PersistentVolumeClaim{
+				ObjectMeta: kapi.ObjectMeta{Name: "data", Namespace: "myproject"},
+				Status:     kapi.PersistentVolumeClaimStatus{Phase: kapi.ClaimBound},
+			}},
+			refused: true,
+		},
+		{
+			name: "pending persistent volume claim",
+			objects: []runtime.Object{&kapi.PersistentVolumeClaim{
+				ObjectMeta: kapi.ObjectMeta{Name: "data", Namespace: "myproject"},
+				Status:     kapi.PersistentVolumeClaimStatus{Phase: kapi.ClaimPending},
+			}},
+		},
+		{
+			name:    "bare pod",
+			objects: []runtime.Object{&kapi.Pod{ObjectMeta: kapi.ObjectMeta{Name: "debug", Namespace: "myproject"}}},
+			refused: true,
+		},
+		{
+			name: "controlled pod",
+			objects: []runtime.Object{&kapi.Pod{ObjectMeta: kapi.ObjectMeta{
+				Name:            "frontend-1-abcde",
+				Namespace:       "myproject",
+				OwnerReferences: []kapi.OwnerReference{{Kind: "ReplicationController", Controller: &controller}},
+			}}},
+		},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			kc := ktestclient.NewSimpleClientset(append(tc.objects, fakeNamespace("myproject"))...)
+			oc := otestclient.NewSimpleFake()
+			a, dir := newTestArchiver(t, kc, oc)
+			defer os.RemoveAll(dir)
+
+			err := a.Archive(fakeNamespace("myproject"), time.Date(2017, time.January, 1, 0, 0, 0, 0, time.UTC))
+			assert.Equal(t, tc.refused, err != nil, "unexpected error: %v", err)
+			assert.Equal(t, !tc.refused, hasDeleteNamespaceAction(kc, "myproject"))
+		})
+	}
+}
@@ -0,0 +1,253 @@
+package archiver
+
+import (
+	authorizationapi "github.com/openshift/origin/pkg/authorization/api"
+	buildapi "github.com/openshift/origin/pkg/build/api"
+	oclient "github.com/openshift/origin/pkg/client"
+	deployapi "github.com/openshift/origin/pkg/deploy/api"
+	imageapi "github.com/openshift/origin/pkg/image/api"
+	routeapi "github.com/openshift/origin/pkg/route/api"
+	templateapi "github.com/openshift/origin/pkg/template/api"
+
+	kapi "k8s.io/kubernetes/pkg/api"
+	"k8s.io/kubernetes/pkg/apis/batch"
+	"k8s.io/kubernetes/pkg/apis/extensions"
+	kclientset "k8s.io/kubernetes/pkg/client/clientset_generated/internalclientset"
+	"k8s.io/kubernetes/pkg/runtime"
+)
+
+// namespacedResource describes a namespaced API resource included in archives, and how to list and create it.
+type namespacedResource struct {
+	kind   string
+	list   func(namespace string) (runtime.Object, error)
+	create func(namespace string, obj runtime.Object) error
+}
+
+// namespacedResources returns all namespaced resource types which are included in an archive, in the order
+// they must be restored so that objects are created after anything they depend on. The namespace itself is
+// handled separately as it must always come first.
+func namespacedResources(oc oclient.Interface, kc kclientset.Interface) []namespacedResource {
+	opts := kapi.ListOptions{}
+	return []namespacedResource{
+		{
+			kind: "LimitRange",
+			list: func(ns string) (runtime.Object, error) { return kc.Core().LimitRanges(ns).List(opts) },
+			create: func(ns string, obj runtime.Object) error {
+				_, err := kc.Core().LimitRanges(ns).Create(obj.(*kapi.LimitRange))
+				return err
+			},
+		},
+		{
+			kind: "ResourceQuota",
+			list: func(ns string) (runtime.Object, error) { return kc.Core().ResourceQuotas(ns).List(opts) },
+			create: func(ns string, obj runtime.Object) error {
+				_, err := kc.Core().ResourceQuotas(ns).Create(obj.(*kapi.ResourceQuota))
+				return err
+			},
+		},
+		{
+			kind: "ServiceAccount",
+			list: func(ns string) (runtime.Object, error) { return kc.Core().ServiceAccounts(ns).List(opts) },
+			create: func(ns string, obj runtime.Object) error {
+				_, err := kc.Core().ServiceAccounts(ns).Create(obj.(*kapi.ServiceAccount))
+				return err
+			},
+		},
+		{
+			kind: "Secret",
+			list: func(ns string) (runtime.Object, error) { return kc.Core().Secrets(ns).List(opts) },
+			create: func(ns string, obj runtime.Object) error {
+				_, err := kc.Core().Secrets(ns).Create(obj.(*kapi.Secret))
+				return err
+			},
+		},
+		{
+			kind: "ConfigMap",
+			list: func(ns string) (runtime.Object, error) { return kc.Core().ConfigMaps(ns).List(opts) },
+			create: func(ns string, obj runtime.Object) error {
+				_, err := kc.Core().ConfigMaps(ns).Create(obj.(*kapi.ConfigMap))
+				return err
+			},
+		},
+		{
+			kind: "PersistentVolumeClaim",
+			list: func(ns string) (runtime.Object, error) { return kc.Core().PersistentVolumeClaims(ns).List(opts) },
+			create: func(ns string, obj runtime.Object) error {
+				_, err := kc.Core().PersistentVolumeClaims(ns).Create(obj.(*kapi.PersistentVolumeClaim))
+				return err
+			},
+		},
+		{
+			kind: "RoleBinding",
+			list: func(ns string) (runtime.Object, error) { return oc.RoleBindings(ns).List(opts) },
+			create: func(ns string, obj runtime.Object) error {
+				_, err := oc.RoleBindings(ns).Create(obj.(*authorizationapi.RoleBinding))
+				return err
+			},
+		},
+		{
+			kind: "Service",
+			list: func(ns string) (runtime.Object, error) { return kc.Core().Services(ns).List(opts) },
+			create: func(ns string, obj runtime.Object) error {
+				_, err := kc.Core().Services(ns).Create(obj.(*kapi.Service))
+				return err
+			},
+		},
+		{
+			kind: "ImageStream",
+			list: func(ns string) (runtime.Object, error) { return oc.ImageStreams(ns).List(opts) },
+			create: func(ns string, obj runtime.Object) error {
+				_, err := oc.ImageStreams(ns).Create(obj.(*imageapi.ImageStream))
+				return err
+			},
+		},
+		{
+			kind: "Template",
+			list: func(ns string) (runtime.Object, error) { return oc.Templates(ns).List(opts) },
+			create: func(ns string, obj runtime.Object) error {
+				_, err := oc.Templates(ns).Create(obj.(*templateapi.Template))
+				return err
+			},
+		},
+		{
+			// Deployments of a DeploymentConfig are restored first so the deployment config controller finds
+			// them, rather than rolling out a conflicting new deployment.
+			kind: "ReplicationController",
+			list: func(ns string) (runtime.Object, error) { return kc.Core().ReplicationControllers(ns).List(opts) },
+			create: func(ns string, obj runtime.Object) error {
+				_, err := kc.Core().ReplicationControllers(ns).Create(obj.(*kapi.ReplicationController))
+				return err
+			},
+		},
+		{
+			kind: "DeploymentConfig",
+			list: func(ns string) (runtime.Object, error) { return oc.DeploymentConfigs(ns).List(opts) },
+			create: func(ns string, obj runtime.Object) error {
+				_, err := oc.DeploymentConfigs(ns).Create(obj.(*deployapi.DeploymentConfig))
+				return err
+			},
+		},
+		{
+			kind: "BuildConfig",
+			list: func(ns string) (runtime.Object, error) { return oc.BuildConfigs(ns).List(opts) },
+			create: func(ns string, obj runtime.Object) error {
+				_, err := oc.BuildConfigs(ns).Create(obj.(*buildapi.BuildConfig))
+				return err
+			},
+		},
+		{
+			kind: "Deployment",
+			list: func(ns string) (runtime.Object, error) { return kc.Extensions().Deployments(ns).List(opts) },
+			create: func(ns string, obj runtime.Object) error {
+				_, err := kc.Extensions().Deployments(ns).Create(obj.(*extensions.Deployment))
+				return err
+			},
+		},
+		{
+			kind: "Job",
+			list: func(ns string) (runtime.Object, error) { return kc.Batch().Jobs(ns).List(opts) },
+			create: func(ns string, obj runtime.Object) error {
+				_, err := kc.Batch().Jobs(ns).Create(obj.(*batch.Job))
+				return err
+			},
+		},
+		{
+			kind: "Route",
+			list: func(ns string) (runtime.Object, error) { return oc.Routes(ns).List(opts) },
+			create: func(ns string, obj runtime.Object) error {
+				_, err := oc.Routes(ns).Create(obj.(*routeapi.Route))
+				return err
+			},
+		},
+	}
+}
+
+// unarchivableResource describes a namespaced resource which archives cannot hold. Deleting a namespace containing
+// one would destroy it permanently, so such namespaces are never archived.
+type unarchivableResource struct {
+	kind string
+	list func(namespace string) (runtime.Object, error)
+	// blocks returns true if the object prevents archival. If nil, every object does.
+	blocks func(obj runtime.Object) bool
+}
+
+// unarchivableResources returns the resources which prevent a namespace from being archived.
+func unarchivableResources(oc oclient.Interface, kc kclientset.Interface) []unarchivableResource {
+	opts := kapi.ListOptions{}
+	return []unarchivableResource{
+		{
+			kind: "StatefulSet",
+			list: func(ns string) (runtime.Object, error) { return kc.Apps().StatefulSets(ns).List(opts) },
+		},
+		{
+			kind: "DaemonSet",
+			list: func(ns string) (runtime.Object, error) { return kc.Extensions().DaemonSets(ns).List(opts) },
+		},
+		{
+			// Owned by a Deployment, which is archived, otherwise created directly:
+			kind: "ReplicaSet",
+			list: func(ns string) (runtime.Object, error) { return kc.Extensions().ReplicaSets(ns).List(opts) },
+			blocks: func(obj runtime.Object) bool {
+				return !hasController(obj.(*extensions.ReplicaSet).OwnerReferences)
+			},
+		},
+		{
+			kind: "HorizontalPodAutoscaler",
+			list: func(ns string) (runtime.Object, error) {
+				return kc.Autoscaling().HorizontalPodAutoscalers(ns).List(opts)
+			},
+		},
+		{
+			kind: "CronJob",
+			list: func(ns string) (runtime.Object, error) { return kc.Batch().CronJobs(ns).List(opts) },
+		},
+		{
+			kind: "Ingress",
+			list: func(ns string) (runtime.Object, error) { return kc.Extensions().Ingresses(ns).List(opts) },
+		},
+		{
+			kind: "NetworkPolicy",
+			list: func(ns string) (runtime.Object, error) { return kc.Extensions().NetworkPolicies(ns).List(opts) },
+		},
+		{
+			kind: "Role",
+			list: func(ns string) (runtime.Object, error) { return oc.Roles(ns).List(opts) },
+		},
+		{
+			// Pods created directly, rather than by an archived controller, build or deployment:
+			kind:   "Pod",
+			list:   func(ns string) (runtime.Object, error) { return kc.Core().Pods(ns).List(opts) },
+			blocks: func(obj runtime.Object) bool { return isBarePod(obj.(*kapi.Pod)) },
+		},
+		{
+			// The claim is archived, but not the data in its volume:
+			kind: "PersistentVolumeClaim",
+			list: func(ns string) (runtime.Object, error) { return kc.Core().PersistentVolumeClaims(ns).List(opts) },
+			blocks: func(obj runtime.Object) bool {
+				return obj.(*kapi.PersistentVolumeClaim).Status.Phase == kapi.ClaimBound
+			},
+		},
+	}
+}
+
+func hasController(refs []kapi.OwnerReference) bool {
+	for _, ref := range refs {
+		if ref.Controller != nil && *ref.Controller {
+			return true
+		}
+	}
+	return false
+}
+
+func isBarePod(pod *kapi.Pod) bool {
+	if _, ok := pod.Annotations[buildapi.BuildAnnotation]; ok {
+		return false
+	}
+	if _, ok := pod.Labels[deployapi.DeployerPodForDeploymentLabel]; ok {
+		return false
+	}
+	if _, ok := pod.Annotations[kapi.CreatedByAnnotation]; ok {
+		return false
+	}
+	return !hasController(pod.OwnerReferences)
+}
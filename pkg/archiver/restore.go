@@ -0,0 +1,296 @@
+package archiver
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/openshift/online/archivist/pkg/archive"
+	"github.com/openshift/online/archivist/pkg/archivestore"
+	"github.com/openshift/online/archivist/pkg/clustermonitor"
+	"github.com/openshift/online/archivist/pkg/config"
+
+	oclient "github.com/openshift/origin/pkg/client"
+	deployapi "github.com/openshift/origin/pkg/deploy/api"
+	imageapi "github.com/openshift/origin/pkg/image/api"
+	routeapi "github.com/openshift/origin/pkg/route/api"
+
+	kapi "k8s.io/kubernetes/pkg/api"
+	kerrors "k8s.io/kubernetes/pkg/api/errors"
+	kunversioned "k8s.io/kubernetes/pkg/api/unversioned"
+	"k8s.io/kubernetes/pkg/apis/batch"
+	"k8s.io/kubernetes/pkg/apis/extensions"
+	kclientset "k8s.io/kubernetes/pkg/client/clientset_generated/internalclientset"
+	"k8s.io/kubernetes/pkg/runtime"
+
+	log "github.com/Sirupsen/logrus"
+)
+
+const (
+	// Annotations set by the persistent volume controller when binding a claim, they must not be restored
+	// as the claim will be bound to a new volume:
+	pvcBindCompletedAnnotation     = "pv.kubernetes.io/bind-completed"
+	pvcBoundByControllerAnnotation = "pv.kubernetes.io/bound-by-controller"
+
+	// Set on the dockercfg secrets OpenShift generates for each service account:
+	serviceAccountTokenSecretAnnotation = "openshift.io/token-secret.name"
+
+	// Set on a namespace while it is being restored, so a restore which failed part way through can be resumed:
+	restoreInProgressAnnotation = "archivist.openshift.io/restore-in-progress"
+
+	// Labels added to the pod template of jobs with a generated selector:
+	jobControllerUIDLabel = "controller-uid"
+	jobNameLabel          = "job-name"
+)
+
+// Restorer recreates archived namespaces from the archive store.
+type Restorer struct {
+	clusterCfg config.ClusterConfig
+	store      archivestore.ArchiveStore
+	oc         oclient.Interface
+	kc         kclientset.Interface
+}
+
+func NewRestorer(clusterConfig config.ClusterConfig, store archivestore.ArchiveStore,
+	oc oclient.Interface, kc kclientset.Interface) *Restorer {
+
+	return &Restorer{
+		clusterCfg: clusterConfig,
+		store:      store,
+		oc:         oc,
+		kc:         kc,
+	}
+}
+
+// Restore recreates a namespace and all objects in its archive. Objects are created in dependency order, with
+// fields populated by the server (UIDs, resource versions, cluster IPs, status etc) cleared so they are assigned
+// afresh. Objects which are generated automatically when a namespace is created, such as service account
+// tokens, are skipped.
+//
+// The namespace must not already exist, unless it is left from a restore which failed part way through, in which
+// case the restore is resumed. The archive is left in the store once the restore completes.
+func (r *Restorer) Restore(namespace string) error {
+	nsLog := log.WithFields(log.Fields{
+		"namespace": namespace,
+		"cluster":   r.clusterCfg.Name,
+		"component": logComponent,
+	})
+	key := archivestore.Key{Cluster: r.clusterCfg.Name, Namespace: namespace}
+	objects, err := r.read(key)
+	if err != nil {
+		return fmt.Errorf("error reading archive %s: %s", key, err)
+	}
+
+	nsObjects := objects["Namespace"]
+	if len(nsObjects) != 1 {
+		return fmt.Errorf("archive %s must contain exactly one namespace, found %d", key, len(nsObjects))
+	}
+	ns := nsObjects[0].(*kapi.Namespace)
+	if ns.Name != namespace {
+		return fmt.Errorf("archive %s contains namespace %s", key, ns.Name)
+	}
+	clearServerFields(ns)
+	clearArchivalAnnotations(ns, time.Now())
+	if ns.Annotations == nil {
+		ns.Annotations = map[string]string{}
+	}
+	ns.Annotations[restoreInProgressAnnotation] = "true"
+	if _, err := r.kc.Core().Namespaces().Create(ns); err != nil {
+		if !kerrors.IsAlreadyExists(err) {
+			return fmt.Errorf("error creating namespace %s: %s", namespace, err)
+		}
+		existing, err := r.kc.Core().Namespaces().Get(namespace)
+		if err != nil {
+			return fmt.Errorf("error getting existing namespace %s: %s", namespace, err)
+		}
+		if _, ok := existing.Annotations[restoreInProgressAnnotation]; !ok {
+			return fmt.Errorf("namespace %s already exists, refusing to restore over it", namespace)
+		}
+		nsLog.Infoln("resuming incomplete restore of namespace")
+	} else {
+		nsLog.Infoln("restored namespace")
+	}
+
+	generatedSecrets := map[string]bool{}
+	for _, obj := range objects["Secret"] {
+		if secret := obj.(*kapi.Secret); isGeneratedSecret(secret) {
+			generatedSecrets[secret.Name] = true
+		}
+	}
+
+	for _, res := range namespacedResources(r.oc, r.kc) {
+		for _, obj := range objects[res.kind] {
+			objMeta, err := kapi.ObjectMetaFor(obj)
+			if err != nil {
+				return err
+			}
+			objLog := nsLog.WithFields(log.Fields{"kind": res.kind, "name": objMeta.Name})
+			if res.kind == "Secret" && generatedSecrets[objMeta.Name] {
+				objLog.Debugln("skipping generated secret")
+				continue
+			}
+			if sa, ok := obj.(*kapi.ServiceAccount); ok {
+				dropSecretReferences(sa, generatedSecrets)
+			}
+			clearServerFields(obj)
+			objMeta.Namespace = namespace
+			if err := res.create(namespace, obj); err != nil {
+				if kerrors.IsAlreadyExists(err) {
+					// Likely created automatically along with the namespace, e.g. the default service accounts:
+					objLog.Debugln("object already exists, skipping")
+					continue
+				}
+				return fmt.Errorf("error restoring %s %s: %s", res.kind, objMeta.Name, err)
+			}
+			objLog.Debugln("restored object")
+		}
+	}
+
+	restored, err := r.kc.Core().Namespaces().Get(namespace)
+	if err != nil {
+		return fmt.Errorf("error getting restored namespace %s: %s", namespace, err)
+	}
+	delete(restored.Annotations, restoreInProgressAnnotation)
+	if _, err := r.kc.Core().Namespaces().Update(restored); err != nil {
+		return fmt.Errorf("error marking restore of namespace %s complete: %s", namespace, err)
+	}
+	nsLog.Infoln("namespace restored")
+	return nil
+}
+
+// read decodes every object in the archive, grouped by kind.
+func (r *Restorer) read(key archivestore.Key) (map[string][]runtime.Object, error) {
+	rc, err := r.store.Get(key)
+	if err != nil {
+		return nil, err
+	}
+	defer rc.Close()
+	a, err := archive.Read(rc)
+	if err != nil {
+		return nil, err
+	}
+	if a.Manifest.Namespace != key.Namespace {
+		return nil, fmt.Errorf("archive contains namespace %s", a.Manifest.Namespace)
+	}
+	log.WithFields(log.Fields{
+		"namespace":        a.Manifest.Namespace,
+		"cluster":          a.Manifest.ClusterName,
+		"archivedAt":       a.Manifest.ArchivedAt,
+		"archivistVersion": a.Manifest.ArchivistVersion,
+		"formatVersion":    a.Manifest.FormatVersion,
+		"objects":          len(a.Manifest.Objects),
+		"component":        logComponent,
+	}).Infoln("read archive")
+
+	objects := map[string][]runtime.Object{}
+	for _, e := range a.Manifest.Objects {
+		obj, err := runtime.Decode(kapi.Codecs.UniversalDecoder(), a.Objects[e.Path])
+		if err != nil {
+			return nil, fmt.Errorf("unable to decode %s: %s", e.Path, err)
+		}
+		// Guard against a mislabelled object being passed to the wrong client:
+		gvks, _, err := kapi.Scheme.ObjectKinds(obj)
+		if err != nil {
+			return nil, err
+		}
+		if gvks[0].Kind != e.Kind {
+			return nil, fmt.Errorf("%s contains a %s", e.Path, gvks[0].Kind)
+		}
+		objects[e.Kind] = append(objects[e.Kind], obj)
+	}
+	return objects, nil
+}
+
+// isGeneratedSecret returns true for the token and dockercfg secrets generated for each service account.
+func isGeneratedSecret(secret *kapi.Secret) bool {
+	if secret.Type == kapi.SecretTypeServiceAccountToken {
+		return true
+	}
+	_, ok := secret.Annotations[serviceAccountTokenSecretAnnotation]
+	return secret.Type == kapi.SecretTypeDockercfg && ok
+}
+
+// clearArchivalAnnotations removes the annotations which no longer apply once a namespace is restored: a request
+// for immediate archival, which would have the namespace archived again at the next capacity check, and an exemption
+// which has expired.
+func clearArchivalAnnotations(ns *kapi.Namespace, now time.Time) {
+	delete(ns.Annotations, clustermonitor.ArchiveImmediatelyAnnotation)
+	if value, ok := ns.Annotations[clustermonitor.ExemptUntilAnnotation]; ok {
+		if exemptUntil, err := clustermonitor.ParseExemptUntil(value); err == nil && !now.Before(exemptUntil) {
+			delete(ns.Annotations, clustermonitor.ExemptUntilAnnotation)
+		}
+	}
+}
+
+// clearServerFields resets metadata, spec and status fields which are populated by the server and cannot be
+// set, or must not be reused, when the object is created again.
+func clearServerFields(obj runtime.Object) {
+	if objMeta, err := kapi.ObjectMetaFor(obj); err == nil {
+		objMeta.ResourceVersion = ""
+		objMeta.UID = ""
+		objMeta.SelfLink = ""
+		objMeta.Generation = 0
+		objMeta.CreationTimestamp = kunversioned.Time{}
+		objMeta.DeletionTimestamp = nil
+		objMeta.DeletionGracePeriodSeconds = nil
+	}
+
+	switch o := obj.(type) {
+	case *kapi.Namespace:
+		o.Status = kapi.NamespaceStatus{}
+	case *kapi.Service:
+		// Headless services must keep their "None" cluster IP:
+		if o.Spec.ClusterIP != kapi.ClusterIPNone {
+			o.Spec.ClusterIP = ""
+		}
+		for i := range o.Spec.Ports {
+			o.Spec.Ports[i].NodePort = 0
+		}
+		o.Status = kapi.ServiceStatus{}
+	case *kapi.PersistentVolumeClaim:
+		o.Spec.VolumeName = ""
+		delete(o.Annotations, pvcBindCompletedAnnotation)
+		delete(o.Annotations, pvcBoundByControllerAnnotation)
+		o.Status = kapi.PersistentVolumeClaimStatus{}
+	case *kapi.ResourceQuota:
+		o.Status = kapi.ResourceQuotaStatus{}
+	case *kapi.ReplicationController:
+		o.Status = kapi.ReplicationControllerStatus{}
+	case *extensions.Deployment:
+		o.Status = extensions.DeploymentStatus{}
+	case *batch.Job:
+		// Jobs with a generated selector reference the UID of the original job, which the server will
+		// regenerate:
+		if o.Spec.ManualSelector == nil || !*o.Spec.ManualSelector {
+			o.Spec.Selector = nil
+			delete(o.Spec.Template.Labels, jobControllerUIDLabel)
+			delete(o.Spec.Template.Labels, jobNameLabel)
+		}
+		o.Status = batch.JobStatus{}
+	case *deployapi.DeploymentConfig:
+		// The latest version is kept so the restored deployments are recognised as belonging to it:
+		o.Status = deployapi.DeploymentConfigStatus{LatestVersion: o.Status.LatestVersion}
+	case *imageapi.ImageStream:
+		o.Status = imageapi.ImageStreamStatus{}
+	case *routeapi.Route:
+		o.Status = routeapi.RouteStatus{}
+	}
+}
+
+// dropSecretReferences removes references to generated secrets which are not being restored. New token
+// secrets will be created for the restored service account.
+func dropSecretReferences(sa *kapi.ServiceAccount, generated map[string]bool) {
+	secrets := make([]kapi.ObjectReference, 0, len(sa.Secrets))
+	for _, ref := range sa.Secrets {
+		if !generated[ref.Name] {
+			secrets = append(secrets, ref)
+		}
+	}
+	sa.Secrets = secrets
+	pullSecrets := make([]kapi.LocalObjectReference, 0, len(sa.ImagePullSecrets))
+	for _, ref := range sa.ImagePullSecrets {
+		if !generated[ref.Name] {
+			pullSecrets = append(pullSecrets, ref)
+		}
+	}
+	sa.ImagePullSecrets = pullSecrets
+}
@@ -0,0 +1,226 @@
+package archiver
+
+import (
+	"errors"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/openshift/online/archivist/pkg/clustermonitor"
+
+	otestclient "github.com/openshift/origin/pkg/client/testclient"
+
+	kapi "k8s.io/kubernetes/pkg/api"
+	kerrors "k8s.io/kubernetes/pkg/api/errors"
+	ktestclient "k8s.io/kubernetes/pkg/client/clientset_generated/internalclientset/fake"
+	ktestcore "k8s.io/kubernetes/pkg/client/testing/core"
+	"k8s.io/kubernetes/pkg/runtime"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// createdObjects returns the objects passed to create actions, in order.
+func createdObjects(actions []ktestcore.Action) []runtime.Object {
+	objects := []runtime.Object{}
+	for _, action := range actions {
+		if createAction, ok := action.(ktestcore.CreateAction); ok {
+			objects = append(objects, createAction.GetObject())
+		}
+	}
+	return objects
+}
+
+func archiveTestNamespace(t *testing.T) (*Archiver, string) {
+	ns := fakeNamespace("myproject")
+	ns.UID = "8c4f6f3a-3c4c-11e7-a9b5-0e8e4e0c8f2a"
+	ns.ResourceVersion = "1234"
+
+	sa := &kapi.ServiceAccount{
+		ObjectMeta: kapi.ObjectMeta{Name: "default", Namespace: "myproject"},
+		Secrets: []kapi.ObjectReference{
+			{Name: "default-token-x7c2p"},
+			{Name: "mysecret"},
+		},
+		ImagePullSecrets: []kapi.LocalObjectReference{{Name: "default-token-x7c2p"}},
+	}
+	token := fakeSecret("myproject", "default-token-x7c2p")
+	token.Type = kapi.SecretTypeServiceAccountToken
+
+	svc := &kapi.Service{
+		ObjectMeta: kapi.ObjectMeta{Name: "frontend", Namespace: "myproject", ResourceVersion: "99"},
+		Spec: kapi.ServiceSpec{
+			ClusterIP: "172.30.12.34",
+			Ports:     []kapi.ServicePort{{Port: 8080, NodePort: 30080}},
+		},
+	}
+	headless := &kapi.Service{
+		ObjectMeta: kapi.ObjectMeta{Name: "headless", Namespace: "myproject"},
+		Spec:       kapi.ServiceSpec{ClusterIP: kapi.ClusterIPNone},
+	}
+
+	kc := ktestclient.NewSimpleClientset(ns, sa, token, fakeSecret("myproject", "mysecret"), svc, headless)
+	oc := otestclient.NewSimpleFake(fakeRoute("myproject", "frontend"))
+	a, dir := newTestArchiver(t, kc, oc)
+	if err := a.Archive(ns, time.Date(2017, time.January, 1, 0, 0, 0, 0, time.UTC)); err != nil {
+		os.RemoveAll(dir)
+		t.Fatal(err)
+	}
+	return a, dir
+}
+
+func TestRestore(t *testing.T) {
+	a, dir := archiveTestNamespace(t)
+	defer os.RemoveAll(dir)
+
+	kc := ktestclient.NewSimpleClientset()
+	oc := otestclient.NewSimpleFake()
+	r := NewRestorer(a.clusterCfg, a.store, oc, kc)
+	if !assert.Nil(t, r.Restore("myproject")) {
+		return
+	}
+
+	created := createdObjects(kc.Actions())
+	var order []string
+	for _, obj := range created {
+		switch o := obj.(type) {
+		case *kapi.Namespace:
+			order = append(order, "Namespace")
+			assert.Equal(t, "", string(o.UID))
+			assert.Equal(t, "", o.ResourceVersion)
+		case *kapi.ServiceAccount:
+			order = append(order, "ServiceAccount")
+			assert.Equal(t, []kapi.ObjectReference{{Name: "mysecret"}}, o.Secrets)
+			assert.Equal(t, 0, len(o.ImagePullSecrets))
+		case *kapi.Secret:
+			order = append(order, "Secret")
+			assert.Equal(t, "mysecret", o.Name)
+		case *kapi.Service:
+			order = append(order, "Service")
+			assert.Equal(t, "", o.ResourceVersion)
+			if o.Name == "headless" {
+				assert.Equal(t, kapi.ClusterIPNone, o.Spec.ClusterIP)
+			} else {
+				assert.Equal(t, "", o.Spec.ClusterIP)
+				assert.Equal(t, int32(0), o.Spec.Ports[0].NodePort)
+			}
+		}
+	}
+	assert.Equal(t, []string{"Namespace", "ServiceAccount", "Secret", "Service", "Service"}, order)
+
+	routes := createdObjects(oc.Actions())
+	assert.Equal(t, 1, len(routes))
+}
+
+func TestRestoreExistingNamespace(t *testing.T) {
+	a, dir := archiveTestNamespace(t)
+	defer os.RemoveAll(dir)
+
+	kc := ktestclient.NewSimpleClientset()
+	kc.PrependReactor("create", "namespaces", func(action ktestcore.Action) (bool, runtime.Object, error) {
+		return true, nil, kerrors.NewAlreadyExists(kapi.Resource("namespaces"), "myproject")
+	})
+	oc := otestclient.NewSimpleFake()
+	r := NewRestorer(a.clusterCfg, a.store, oc, kc)
+
+	assert.NotNil(t, r.Restore("myproject"))
+	// Nothing else should be created in a namespace which already existed:
+	assert.Equal(t, 1, len(createdObjects(kc.Actions())))
+	assert.Equal(t, 0, len(createdObjects(oc.Actions())))
+}
+
+func TestRestoreResumed(t *testing.T) {
+	a, dir := archiveTestNamespace(t)
+	defer os.RemoveAll(dir)
+
+	kc := ktestclient.NewSimpleClientset()
+	failed := false
+	kc.PrependReactor("create", "services", func(action ktestcore.Action) (bool, runtime.Object, error) {
+		if !failed {
+			failed = true
+			return true, nil, errors.New("service creation failed")
+		}
+		return false, nil, nil
+	})
+	r := NewRestorer(a.clusterCfg, a.store, otestclient.NewSimpleFake(), kc)
+
+	assert.NotNil(t, r.Restore("myproject"))
+	ns, err := kc.Core().Namespaces().Get("myproject")
+	if assert.Nil(t, err) {
+		assert.Equal(t, "true", ns.Annotations[restoreInProgressAnnotation])
+	}
+
+	// The retry continues in the partially restored namespace:
+	if !assert.Nil(t, r.Restore("myproject")) {
+		return
+	}
+	for _, name := range []string{"frontend", "headless"} {
+		_, err := kc.Core().Services("myproject").Get(name)
+		assert.Nil(t, err, "service %s not restored", name)
+	}
+	ns, err = kc.Core().Namespaces().Get("myproject")
+	if assert.Nil(t, err) {
+		_, inProgress := ns.Annotations[restoreInProgressAnnotation]
+		assert.False(t, inProgress)
+	}
+
+	// A completed restore is not repeated:
+	assert.NotNil(t, r.Restore("myproject"))
+}
+
+func TestRestoreArchivalAnnotations(t *testing.T) {
+	tests := []struct {
+		name        string
+		exemptUntil string
+		expected    map[string]string
+	}{
+		{
+			name:        "expired exemption",
+			exemptUntil: "2017-01-01",
+			expected:    map[string]string{"openshift.io/requester": "user1"},
+		},
+		{
+			name:        "current exemption",
+			exemptUntil: "2999-01-01",
+			expected: map[string]string{
+				"openshift.io/requester":             "user1",
+				clustermonitor.ExemptUntilAnnotation: "2999-01-01",
+			},
+		},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			ns := fakeNamespace("myproject")
+			ns.Annotations = map[string]string{
+				"openshift.io/requester":                    "user1",
+				clustermonitor.ArchiveImmediatelyAnnotation: "true",
+				clustermonitor.ExemptUntilAnnotation:        tc.exemptUntil,
+			}
+			a, dir := newTestArchiver(t, ktestclient.NewSimpleClientset(ns), otestclient.NewSimpleFake())
+			defer os.RemoveAll(dir)
+			if !assert.Nil(t, a.Archive(ns, time.Date(2017, time.January, 1, 0, 0, 0, 0, time.UTC))) {
+				return
+			}
+
+			kc := ktestclient.NewSimpleClientset()
+			r := NewRestorer(a.clusterCfg, a.store, otestclient.NewSimpleFake(), kc)
+			if !assert.Nil(t, r.Restore("myproject")) {
+				return
+			}
+			// The restored namespace must not be archived again at the next capacity check:
+			restored, err := kc.Core().Namespaces().Get("myproject")
+			if assert.Nil(t, err) {
+				assert.Equal(t, tc.expected, restored.Annotations)
+			}
+		})
+	}
+}
+
+func TestRestoreMissingArchive(t *testing.T) {
+	a, dir := archiveTestNamespace(t)
+	defer os.RemoveAll(dir)
+
+	kc := ktestclient.NewSimpleClientset()
+	r := NewRestorer(a.clusterCfg, a.store, otestclient.NewSimpleFake(), kc)
+	assert.NotNil(t, r.Restore("no-such-project"))
+	assert.Equal(t, 0, len(createdObjects(kc.Actions())))
+}
@@ -0,0 +1,68 @@
+package archivestore
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/openshift/online/archivist/pkg/config"
+)
+
+// ErrNotFound is returned when an archive does not exist in the store.
+var ErrNotFound = errors.New("archive not found")
+
+// Key identifies the archive for a single namespace.
+type Key struct {
+	Cluster   string
+	Namespace string
+}
+
+func (k Key) String() string {
+	return k.Cluster + "/" + k.Namespace
+}
+
+// Validate checks the key can be safely used to build a storage path.
+func (k Key) Validate() error {
+	for _, part := range []string{k.Cluster, k.Namespace} {
+		if part == "" || part == "." || part == ".." || strings.ContainsAny(part, "/\\") {
+			return fmt.Errorf("invalid archive key: %q", k.String())
+		}
+	}
+	return nil
+}
+
+// ArchiveInfo describes an archive held in the store.
+type ArchiveInfo struct {
+	Key     Key
+	Size    int64
+	ModTime time.Time
+}
+
+// ArchiveStore stores namespace archives. Implementations must not expose partially written archives, a Put
+// either replaces the archive in full or leaves any existing archive untouched.
+type ArchiveStore interface {
+	// Put stores the archive read from r, replacing any existing archive for the key.
+	Put(key Key, r io.Reader) error
+	// Get opens the archive for reading. The caller must close the returned reader.
+	Get(key Key) (io.ReadCloser, error)
+	// Stat returns information on a single archive.
+	Stat(key Key) (ArchiveInfo, error)
+	// List returns information on all archives stored for a cluster.
+	List(cluster string) ([]ArchiveInfo, error)
+	// Delete removes an archive.
+	Delete(key Key) error
+}
+
+// NewArchiveStore creates the archive store selected by the configuration.
+func NewArchiveStore(cfg config.ArchiveStoreConfig) (ArchiveStore, error) {
+	switch cfg.Type {
+	case config.FilesystemArchiveStore:
+		return NewFilesystemStore(cfg.Filesystem.Path)
+	case config.S3ArchiveStore:
+		return NewS3Store(cfg.S3)
+	default:
+		return nil, fmt.Errorf("unknown archive store type: %s", cfg.Type)
+	}
+}
@@ -0,0 +1,125 @@
+package archivestore
+
+import (
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+const archiveExt = ".tar.gz"
+
+// FilesystemStore stores archives on a local filesystem, one directory per cluster and one file per namespace.
+type FilesystemStore struct {
+	root string
+}
+
+// NewFilesystemStore returns a store rooted at the given directory, creating it if necessary.
+func NewFilesystemStore(root string) (*FilesystemStore, error) {
+	if err := os.MkdirAll(root, 0755); err != nil {
+		return nil, err
+	}
+	return &FilesystemStore{root: root}, nil
+}
+
+func (s *FilesystemStore) path(key Key) string {
+	return filepath.Join(s.root, key.Cluster, key.Namespace+archiveExt)
+}
+
+// Put writes the archive to a temporary file and renames it into place once complete.
+func (s *FilesystemStore) Put(key Key, r io.Reader) error {
+	if err := key.Validate(); err != nil {
+		return err
+	}
+	dir := filepath.Join(s.root, key.Cluster)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+	// Temporary files are dot-prefixed so List never reports them:
+	tmp, err := ioutil.TempFile(dir, "."+key.Namespace)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(tmp, r); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return err
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	if err := os.Rename(tmp.Name(), s.path(key)); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	return nil
+}
+
+func (s *FilesystemStore) Get(key Key) (io.ReadCloser, error) {
+	if err := key.Validate(); err != nil {
+		return nil, err
+	}
+	f, err := os.Open(s.path(key))
+	if os.IsNotExist(err) {
+		return nil, ErrNotFound
+	}
+	return f, err
+}
+
+func (s *FilesystemStore) Stat(key Key) (ArchiveInfo, error) {
+	if err := key.Validate(); err != nil {
+		return ArchiveInfo{}, err
+	}
+	fi, err := os.Stat(s.path(key))
+	if os.IsNotExist(err) {
+		return ArchiveInfo{}, ErrNotFound
+	}
+	if err != nil {
+		return ArchiveInfo{}, err
+	}
+	return ArchiveInfo{Key: key, Size: fi.Size(), ModTime: fi.ModTime()}, nil
+}
+
+func (s *FilesystemStore) List(cluster string) ([]ArchiveInfo, error) {
+	if err := (Key{Cluster: cluster, Namespace: "list"}).Validate(); err != nil {
+		return nil, err
+	}
+	entries, err := ioutil.ReadDir(filepath.Join(s.root, cluster))
+	if os.IsNotExist(err) {
+		return []ArchiveInfo{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	archives := make([]ArchiveInfo, 0, len(entries))
+	for _, fi := range entries {
+		name := fi.Name()
+		if !fi.Mode().IsRegular() || strings.HasPrefix(name, ".") || !strings.HasSuffix(name, archiveExt) {
+			continue
+		}
+		archives = append(archives, ArchiveInfo{
+			Key:     Key{Cluster: cluster, Namespace: strings.TrimSuffix(name, archiveExt)},
+			Size:    fi.Size(),
+			ModTime: fi.ModTime(),
+		})
+	}
+	return archives, nil
+}
+
+func (s *FilesystemStore) Delete(key Key) error {
+	if err := key.Validate(); err != nil {
+		return err
+	}
+	err := os.Remove(s.path(key))
+	if os.IsNotExist(err) {
+		return ErrNotFound
+	}
+	return err
+}
@@ -0,0 +1,86 @@
+package archivestore
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func newTestFilesystemStore(t *testing.T) (*FilesystemStore, string) {
+	dir, err := ioutil.TempDir("", "archivestore")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s, err := NewFilesystemStore(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return s, dir
+}
+
+func TestFilesystemStore(t *testing.T) {
+	s, dir := newTestFilesystemStore(t)
+	defer os.RemoveAll(dir)
+
+	key1 := Key{Cluster: "test cluster", Namespace: "namespace1"}
+	key2 := Key{Cluster: "test cluster", Namespace: "namespace2"}
+	otherKey := Key{Cluster: "other cluster", Namespace: "namespace1"}
+
+	for _, k := range []Key{key1, key2, otherKey} {
+		if !assert.Nil(t, s.Put(k, bytes.NewBufferString("archive of "+k.String()))) {
+			return
+		}
+	}
+	// Replace an existing archive:
+	if !assert.Nil(t, s.Put(key1, bytes.NewBufferString("new archive"))) {
+		return
+	}
+
+	r, err := s.Get(key1)
+	if assert.Nil(t, err) {
+		data, err := ioutil.ReadAll(r)
+		r.Close()
+		assert.Nil(t, err)
+		assert.Equal(t, "new archive", string(data))
+	}
+
+	info, err := s.Stat(key2)
+	if assert.Nil(t, err) {
+		assert.Equal(t, key2, info.Key)
+		assert.Equal(t, int64(len("archive of test cluster/namespace2")), info.Size)
+	}
+
+	archives, err := s.List("test cluster")
+	if assert.Nil(t, err) {
+		assert.Equal(t, 2, len(archives))
+	}
+
+	assert.Nil(t, s.Delete(key2))
+	_, err = s.Stat(key2)
+	assert.Equal(t, ErrNotFound, err)
+	_, err = s.Get(key2)
+	assert.Equal(t, ErrNotFound, err)
+	assert.Equal(t, ErrNotFound, s.Delete(key2))
+
+	archives, err = s.List("no such cluster")
+	if assert.Nil(t, err) {
+		assert.Equal(t, 0, len(archives))
+	}
+}
+
+func TestFilesystemStoreInvalidKeys(t *testing.T) {
+	s, dir := newTestFilesystemStore(t)
+	defer os.RemoveAll(dir)
+
+	for _, k := range []Key{
+		{Cluster: "", Namespace: "namespace1"},
+		{Cluster: "test cluster", Namespace: ""},
+		{Cluster: "..", Namespace: "namespace1"},
+		{Cluster: "test cluster", Namespace: "../../etc"},
+	} {
+		assert.NotNil(t, s.Put(k, bytes.NewBufferString("archive")), "key %s", k)
+	}
+}
@@ -0,0 +1,513 @@
+package archivestore
+
+import (
+	"bytes"
+	"crypto/md5"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/xml"
+	"fmt"
+	"hash"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/openshift/online/archivist/pkg/config"
+)
+
+const (
+	// S3 rejects multipart uploads with parts (other than the last) smaller than this:
+	minS3PartSize = 5 * 1024 * 1024
+
+	// partSizeMetaHeader records the part size an archive was uploaded with, so the ETag of multipart
+	// uploads can be recomputed when the archive is downloaded.
+	partSizeMetaHeader = "X-Amz-Meta-Archivist-Part-Size"
+)
+
+// S3Store stores archives in a bucket of an S3 compatible object store, using path style requests so it
+// works with MinIO and similar servers as well as AWS.
+//
+// Every request carries a Content-MD5 header so the server rejects corrupted uploads, the ETag of a completed
+// upload is compared against the locally computed value, and downloads are checked against the ETag before
+// the final read returns.
+type S3Store struct {
+	endpoint        *url.URL
+	region          string
+	bucket          string
+	prefix          string
+	accessKeyID     string
+	secretAccessKey string
+	partSize        int64
+	client          *http.Client
+}
+
+// NewS3Store returns a store for the configured bucket. Credentials not present in the configuration are
+// read from the standard AWS_ACCESS_KEY_ID and AWS_SECRET_ACCESS_KEY environment variables.
+func NewS3Store(cfg config.S3StoreConfig) (*S3Store, error) {
+	endpoint, err := url.Parse(cfg.Endpoint)
+	if err != nil {
+		return nil, fmt.Errorf("invalid S3 endpoint: %s", err)
+	}
+	if endpoint.Scheme != "http" && endpoint.Scheme != "https" {
+		return nil, fmt.Errorf("invalid S3 endpoint, must be http or https: %s", cfg.Endpoint)
+	}
+	if cfg.Bucket == "" {
+		return nil, fmt.Errorf("no S3 bucket specified")
+	}
+	s := &S3Store{
+		endpoint:        endpoint,
+		region:          cfg.Region,
+		bucket:          cfg.Bucket,
+		prefix:          strings.Trim(cfg.Prefix, "/"),
+		accessKeyID:     cfg.AccessKeyID,
+		secretAccessKey: cfg.SecretAccessKey,
+		partSize:        int64(cfg.PartSizeMB) * 1024 * 1024,
+		client:          &http.Client{Timeout: cfg.Timeout},
+	}
+	if s.accessKeyID == "" {
+		s.accessKeyID = os.Getenv("AWS_ACCESS_KEY_ID")
+	}
+	if s.secretAccessKey == "" {
+		s.secretAccessKey = os.Getenv("AWS_SECRET_ACCESS_KEY")
+	}
+	if s.partSize < minS3PartSize {
+		return nil, fmt.Errorf("S3 part size must be at least %d bytes", minS3PartSize)
+	}
+	return s, nil
+}
+
+func (s *S3Store) clusterPrefix(cluster string) string {
+	if s.prefix == "" {
+		return cluster + "/"
+	}
+	return s.prefix + "/" + cluster + "/"
+}
+
+func (s *S3Store) objectKey(key Key) string {
+	return s.clusterPrefix(key.Cluster) + key.Namespace + archiveExt
+}
+
+// Put uploads the archive in a single request if it fits within one part, otherwise as a multipart upload.
+func (s *S3Store) Put(key Key, r io.Reader) error {
+	if err := key.Validate(); err != nil {
+		return err
+	}
+	objectKey := s.objectKey(key)
+	first, eof, err := readPart(r, s.partSize)
+	if err != nil {
+		return err
+	}
+	if eof {
+		return s.putObject(objectKey, first)
+	}
+	return s.putMultipart(objectKey, first, r)
+}
+
+func (s *S3Store) putObject(objectKey string, data []byte) error {
+	sum := md5.Sum(data)
+	header := http.Header{}
+	header.Set("Content-MD5", base64.StdEncoding.EncodeToString(sum[:]))
+	resp, err := s.do("PUT", objectKey, nil, header, data)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return responseError(resp)
+	}
+	return checkETag(resp.Header.Get("ETag"), hex.EncodeToString(sum[:]))
+}
+
+type initiateMultipartUploadResult struct {
+	UploadID string `xml:"UploadId"`
+}
+
+type completedPart struct {
+	PartNumber int    `xml:"PartNumber"`
+	ETag       string `xml:"ETag"`
+}
+
+type completeMultipartUpload struct {
+	XMLName xml.Name        `xml:"CompleteMultipartUpload"`
+	Parts   []completedPart `xml:"Part"`
+}
+
+type completeMultipartUploadResult struct {
+	XMLName xml.Name
+	ETag    string `xml:"ETag"`
+	Code    string `xml:"Code"`
+	Message string `xml:"Message"`
+}
+
+func (s *S3Store) putMultipart(objectKey string, first []byte, r io.Reader) error {
+	header := http.Header{}
+	header.Set(partSizeMetaHeader, strconv.FormatInt(s.partSize, 10))
+	resp, err := s.do("POST", objectKey, url.Values{"uploads": {""}}, header, nil)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return responseError(resp)
+	}
+	var initiated initiateMultipartUploadResult
+	if err := xml.NewDecoder(resp.Body).Decode(&initiated); err != nil {
+		return fmt.Errorf("error decoding multipart upload response: %s", err)
+	}
+
+	if err := s.uploadParts(objectKey, initiated.UploadID, first, r); err != nil {
+		// Abort so the parts do not linger in the bucket. The original error is more interesting than any
+		// failure to abort:
+		if resp, abortErr := s.do("DELETE", objectKey, url.Values{"uploadId": {initiated.UploadID}}, nil, nil); abortErr == nil {
+			resp.Body.Close()
+		}
+		return err
+	}
+	return nil
+}
+
+func (s *S3Store) uploadParts(objectKey, uploadID string, data []byte, r io.Reader) error {
+	etag := newETagHash(s.partSize)
+	complete := completeMultipartUpload{}
+	for partNumber := 1; ; partNumber++ {
+		sum := md5.Sum(data)
+		header := http.Header{}
+		header.Set("Content-MD5", base64.StdEncoding.EncodeToString(sum[:]))
+		query := url.Values{
+			"partNumber": {strconv.Itoa(partNumber)},
+			"uploadId":   {uploadID},
+		}
+		resp, err := s.do("PUT", objectKey, query, header, data)
+		if err != nil {
+			return err
+		}
+		if resp.StatusCode != http.StatusOK {
+			err = responseError(resp)
+			resp.Body.Close()
+			return err
+		}
+		resp.Body.Close()
+		partETag := resp.Header.Get("ETag")
+		if err := checkETag(partETag, hex.EncodeToString(sum[:])); err != nil {
+			return fmt.Errorf("part %d: %s", partNumber, err)
+		}
+		etag.Write(data)
+		complete.Parts = append(complete.Parts, completedPart{PartNumber: partNumber, ETag: partETag})
+
+		var eof bool
+		data, eof, err = readPart(r, s.partSize)
+		if err != nil {
+			return err
+		}
+		if len(data) == 0 {
+			break
+		}
+		if eof {
+			// Upload the final short part on the next pass, and stop after it:
+			r = bytes.NewReader(nil)
+		}
+	}
+
+	body, err := xml.Marshal(complete)
+	if err != nil {
+		return err
+	}
+	resp, err := s.do("POST", objectKey, url.Values{"uploadId": {uploadID}}, nil, body)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return responseError(resp)
+	}
+	// S3 may report a failure to complete with a 200 status and an error document:
+	var result completeMultipartUploadResult
+	if err := xml.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return fmt.Errorf("error decoding complete multipart upload response: %s", err)
+	}
+	if result.XMLName.Local == "Error" {
+		return fmt.Errorf("S3 error completing multipart upload: %s: %s", result.Code, result.Message)
+	}
+	return checkETag(result.ETag, etag.Sum())
+}
+
+func (s *S3Store) Get(key Key) (io.ReadCloser, error) {
+	if err := key.Validate(); err != nil {
+		return nil, err
+	}
+	resp, err := s.do("GET", s.objectKey(key), nil, nil, nil)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode == http.StatusNotFound {
+		resp.Body.Close()
+		return nil, ErrNotFound
+	}
+	if resp.StatusCode != http.StatusOK {
+		defer resp.Body.Close()
+		return nil, responseError(resp)
+	}
+	partSize, _ := strconv.ParseInt(resp.Header.Get(partSizeMetaHeader), 10, 64)
+	return &verifyingReader{
+		body:     resp.Body,
+		etag:     newETagHash(partSize),
+		expected: strings.Trim(resp.Header.Get("ETag"), `"`),
+	}, nil
+}
+
+func (s *S3Store) Stat(key Key) (ArchiveInfo, error) {
+	if err := key.Validate(); err != nil {
+		return ArchiveInfo{}, err
+	}
+	resp, err := s.do("HEAD", s.objectKey(key), nil, nil, nil)
+	if err != nil {
+		return ArchiveInfo{}, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode == http.StatusNotFound {
+		return ArchiveInfo{}, ErrNotFound
+	}
+	if resp.StatusCode != http.StatusOK {
+		return ArchiveInfo{}, responseError(resp)
+	}
+	modTime, _ := http.ParseTime(resp.Header.Get("Last-Modified"))
+	return ArchiveInfo{Key: key, Size: resp.ContentLength, ModTime: modTime}, nil
+}
+
+type listBucketResult struct {
+	IsTruncated           bool   `xml:"IsTruncated"`
+	NextContinuationToken string `xml:"NextContinuationToken"`
+	Contents              []struct {
+		Key          string    `xml:"Key"`
+		Size         int64     `xml:"Size"`
+		LastModified time.Time `xml:"LastModified"`
+	} `xml:"Contents"`
+}
+
+func (s *S3Store) List(cluster string) ([]ArchiveInfo, error) {
+	if err := (Key{Cluster: cluster, Namespace: "list"}).Validate(); err != nil {
+		return nil, err
+	}
+	prefix := s.clusterPrefix(cluster)
+	archives := []ArchiveInfo{}
+	query := url.Values{
+		"list-type": {"2"},
+		"prefix":    {prefix},
+		"delimiter": {"/"},
+	}
+	for {
+		resp, err := s.do("GET", "", query, nil, nil)
+		if err != nil {
+			return nil, err
+		}
+		if resp.StatusCode != http.StatusOK {
+			err = responseError(resp)
+			resp.Body.Close()
+			return nil, err
+		}
+		var result listBucketResult
+		err = xml.NewDecoder(resp.Body).Decode(&result)
+		resp.Body.Close()
+		if err != nil {
+			return nil, fmt.Errorf("error decoding bucket listing: %s", err)
+		}
+		for _, c := range result.Contents {
+			name := strings.TrimPrefix(c.Key, prefix)
+			if strings.Contains(name, "/") || !strings.HasSuffix(name, archiveExt) {
+				continue
+			}
+			archives = append(archives, ArchiveInfo{
+				Key:     Key{Cluster: cluster, Namespace: strings.TrimSuffix(name, archiveExt)},
+				Size:    c.Size,
+				ModTime: c.LastModified,
+			})
+		}
+		if !result.IsTruncated || result.NextContinuationToken == "" {
+			break
+		}
+		query.Set("continuation-token", result.NextContinuationToken)
+	}
+	return archives, nil
+}
+
+// Delete removes the archive. S3 reports success when deleting a missing object, so existence is checked first
+// to match the behaviour of the other stores.
+func (s *S3Store) Delete(key Key) error {
+	if _, err := s.Stat(key); err != nil {
+		return err
+	}
+	resp, err := s.do("DELETE", s.objectKey(key), nil, nil, nil)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusNoContent && resp.StatusCode != http.StatusOK {
+		return responseError(resp)
+	}
+	return nil
+}
+
+// do sends a signed request for an object in the bucket, or for the bucket itself if objectKey is empty.
+func (s *S3Store) do(method, objectKey string, query url.Values, header http.Header, body []byte) (*http.Response, error) {
+	u := *s.endpoint
+	u.Path = "/" + s.bucket
+	if objectKey != "" {
+		u.Path += "/" + objectKey
+	}
+	u.RawPath = uriEncode(u.Path, false)
+	u.RawQuery = canonicalQuery(query)
+
+	req, err := http.NewRequest(method, u.String(), bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	req.ContentLength = int64(len(body))
+	for name, values := range header {
+		req.Header[name] = values
+	}
+	signRequest(req, s.accessKeyID, s.secretAccessKey, s.region, sha256Hex(body), time.Now())
+	return s.client.Do(req)
+}
+
+type s3Error struct {
+	Code    string `xml:"Code"`
+	Message string `xml:"Message"`
+}
+
+func responseError(resp *http.Response) error {
+	var e s3Error
+	data, _ := ioutil.ReadAll(resp.Body)
+	if xml.Unmarshal(data, &e) != nil || e.Code == "" {
+		return fmt.Errorf("unexpected S3 response: %s", resp.Status)
+	}
+	return fmt.Errorf("S3 error: %s: %s", e.Code, e.Message)
+}
+
+// readPart reads up to size bytes, reporting whether the end of the reader was reached.
+func readPart(r io.Reader, size int64) ([]byte, bool, error) {
+	buf := make([]byte, size)
+	n, err := io.ReadFull(r, buf)
+	if err == io.EOF || err == io.ErrUnexpectedEOF {
+		return buf[:n], true, nil
+	}
+	if err != nil {
+		return nil, false, err
+	}
+	return buf, false, nil
+}
+
+func checkETag(etag string, expected string) error {
+	if strings.Trim(etag, `"`) != expected {
+		return fmt.Errorf("checksum mismatch, server reported ETag %s, expected %s", etag, expected)
+	}
+	return nil
+}
+
+// etagHash computes the ETag S3 assigns to an object: the MD5 digest of the content for single part uploads,
+// or the MD5 digest of the concatenated part digests followed by the part count for multipart uploads.
+type etagHash struct {
+	partSize  int64
+	written   int64
+	current   hash.Hash
+	partSums  []byte
+	partCount int
+}
+
+func newETagHash(partSize int64) *etagHash {
+	return &etagHash{partSize: partSize, current: md5.New()}
+}
+
+func (h *etagHash) Write(p []byte) {
+	if h.partSize <= 0 {
+		h.current.Write(p)
+		return
+	}
+	for len(p) > 0 {
+		n := h.partSize - h.written
+		if int64(len(p)) < n {
+			n = int64(len(p))
+		}
+		h.current.Write(p[:n])
+		h.written += n
+		p = p[n:]
+		if h.written == h.partSize {
+			h.finishPart()
+		}
+	}
+}
+
+func (h *etagHash) finishPart() {
+	h.partSums = h.current.Sum(h.partSums)
+	h.partCount++
+	h.current = md5.New()
+	h.written = 0
+}
+
+func (h *etagHash) Sum() string {
+	if h.partSize <= 0 {
+		return hex.EncodeToString(h.current.Sum(nil))
+	}
+	if h.written > 0 {
+		h.finishPart()
+	}
+	sum := md5.Sum(h.partSums)
+	return fmt.Sprintf("%s-%d", hex.EncodeToString(sum[:]), h.partCount)
+}
+
+// verifyingReader returns an error instead of io.EOF if the downloaded content does not match the ETag.
+type verifyingReader struct {
+	body     io.ReadCloser
+	etag     *etagHash
+	expected string
+}
+
+func (r *verifyingReader) Read(p []byte) (int, error) {
+	n, err := r.body.Read(p)
+	r.etag.Write(p[:n])
+	if err == io.EOF {
+		if sum := r.etag.Sum(); sum != r.expected {
+			return n, fmt.Errorf("checksum mismatch, downloaded archive has ETag %s, expected %s", sum, r.expected)
+		}
+	}
+	return n, err
+}
+
+func (r *verifyingReader) Close() error {
+	return r.body.Close()
+}
+
+// uriEncode encodes a string as required by AWS signature version 4, optionally leaving slashes intact.
+func uriEncode(s string, encodeSlash bool) string {
+	var buf bytes.Buffer
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if (c >= 'A' && c <= 'Z') || (c >= 'a' && c <= 'z') || (c >= '0' && c <= '9') ||
+			c == '-' || c == '_' || c == '.' || c == '~' || (c == '/' && !encodeSlash) {
+			buf.WriteByte(c)
+		} else {
+			fmt.Fprintf(&buf, "%%%02X", c)
+		}
+	}
+	return buf.String()
+}
+
+func canonicalQuery(query url.Values) string {
+	keys := make([]string, 0, len(query))
+	for k := range query {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	parts := make([]string, 0, len(keys))
+	for _, k := range keys {
+		for _, v := range query[k] {
+			parts = append(parts, uriEncode(k, true)+"="+uriEncode(v, true))
+		}
+	}
+	return strings.Join(parts, "&")
+}
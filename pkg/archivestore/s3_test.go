@@ -0,0 +1,359 @@
+package archivestore
+
+import (
+	"bytes"
+	"crypto/md5"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/xml"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/openshift/online/archivist/pkg/config"
+
+	"github.com/stretchr/testify/assert"
+)
+
+const (
+	testAccessKeyID     = "AKIDEXAMPLE"
+	testSecretAccessKey = "wJalrXUtnFEMI/K7MDENG+bPxRfiCYEXAMPLEKEY"
+	testBucket          = "archives"
+)
+
+type fakeS3Object struct {
+	data     []byte
+	etag     string
+	partSize string
+	modTime  time.Time
+}
+
+type fakeS3Upload struct {
+	key      string
+	partSize string
+	parts    map[int][]byte
+}
+
+// fakeS3 is a minimal in-memory stand-in for an S3 server. It checks request signatures and Content-MD5
+// headers the way a real server would.
+type fakeS3 struct {
+	sync.Mutex
+	objects    map[string]*fakeS3Object
+	uploads    map[string]*fakeS3Upload
+	nextUpload int
+	// failPart causes the upload of the given part number to be rejected.
+	failPart int
+	aborted  int
+}
+
+func newFakeS3() *fakeS3 {
+	return &fakeS3{objects: map[string]*fakeS3Object{}, uploads: map[string]*fakeS3Upload{}}
+}
+
+func writeS3Error(w http.ResponseWriter, status int, code string) {
+	w.WriteHeader(status)
+	fmt.Fprintf(w, "<Error><Code>%s</Code><Message>%s</Message></Error>", code, code)
+}
+
+func (f *fakeS3) checkSignature(r *http.Request, body []byte) bool {
+	auth := r.Header.Get("Authorization")
+	parts := strings.Split(strings.TrimPrefix(auth, sigV4Algorithm+" "), ", ")
+	if len(parts) != 3 {
+		return false
+	}
+	signedHeaders := strings.Split(strings.TrimPrefix(parts[1], "SignedHeaders="), ";")
+	payloadHash := r.Header.Get("X-Amz-Content-Sha256")
+	if payloadHash != sha256Hex(body) {
+		return false
+	}
+	expected := sigV4Signature(testSecretAccessKey, "us-east-1", r.Header.Get("X-Amz-Date"), r.Method,
+		r.URL.Path, r.URL.Query(), r.Header, r.Host, signedHeaders, payloadHash)
+	return strings.TrimPrefix(parts[2], "Signature=") == expected
+}
+
+func (f *fakeS3) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.Lock()
+	defer f.Unlock()
+
+	body, _ := ioutil.ReadAll(r.Body)
+	if !f.checkSignature(r, body) {
+		writeS3Error(w, http.StatusForbidden, "SignatureDoesNotMatch")
+		return
+	}
+	if contentMD5 := r.Header.Get("Content-MD5"); contentMD5 != "" {
+		sum := md5.Sum(body)
+		if contentMD5 != base64.StdEncoding.EncodeToString(sum[:]) {
+			writeS3Error(w, http.StatusBadRequest, "BadDigest")
+			return
+		}
+	}
+	if !strings.HasPrefix(r.URL.Path, "/"+testBucket) {
+		writeS3Error(w, http.StatusNotFound, "NoSuchBucket")
+		return
+	}
+	key := strings.TrimPrefix(strings.TrimPrefix(r.URL.Path, "/"+testBucket), "/")
+	query := r.URL.Query()
+
+	switch {
+	case r.Method == "GET" && key == "":
+		f.list(w, query.Get("prefix"))
+	case r.Method == "POST" && query["uploads"] != nil:
+		f.nextUpload++
+		id := strconv.Itoa(f.nextUpload)
+		f.uploads[id] = &fakeS3Upload{key: key, partSize: r.Header.Get(partSizeMetaHeader), parts: map[int][]byte{}}
+		fmt.Fprintf(w, "<InitiateMultipartUploadResult><UploadId>%s</UploadId></InitiateMultipartUploadResult>", id)
+	case r.Method == "PUT" && query.Get("uploadId") != "":
+		upload, ok := f.uploads[query.Get("uploadId")]
+		if !ok {
+			writeS3Error(w, http.StatusNotFound, "NoSuchUpload")
+			return
+		}
+		partNumber, _ := strconv.Atoi(query.Get("partNumber"))
+		if partNumber == f.failPart {
+			writeS3Error(w, http.StatusInternalServerError, "InternalError")
+			return
+		}
+		upload.parts[partNumber] = body
+		sum := md5.Sum(body)
+		w.Header().Set("ETag", `"`+hex.EncodeToString(sum[:])+`"`)
+	case r.Method == "POST" && query.Get("uploadId") != "":
+		upload, ok := f.uploads[query.Get("uploadId")]
+		if !ok {
+			writeS3Error(w, http.StatusNotFound, "NoSuchUpload")
+			return
+		}
+		var complete completeMultipartUpload
+		if err := xml.Unmarshal(body, &complete); err != nil {
+			writeS3Error(w, http.StatusBadRequest, "MalformedXML")
+			return
+		}
+		var data, sums []byte
+		for _, p := range complete.Parts {
+			data = append(data, upload.parts[p.PartNumber]...)
+			sum := md5.Sum(upload.parts[p.PartNumber])
+			sums = append(sums, sum[:]...)
+		}
+		sum := md5.Sum(sums)
+		etag := fmt.Sprintf("%s-%d", hex.EncodeToString(sum[:]), len(complete.Parts))
+		f.objects[upload.key] = &fakeS3Object{data: data, etag: etag, partSize: upload.partSize, modTime: time.Now()}
+		delete(f.uploads, query.Get("uploadId"))
+		fmt.Fprintf(w, `<CompleteMultipartUploadResult><ETag>"%s"</ETag></CompleteMultipartUploadResult>`, etag)
+	case r.Method == "DELETE" && query.Get("uploadId") != "":
+		delete(f.uploads, query.Get("uploadId"))
+		f.aborted++
+		w.WriteHeader(http.StatusNoContent)
+	case r.Method == "PUT":
+		sum := md5.Sum(body)
+		f.objects[key] = &fakeS3Object{data: body, etag: hex.EncodeToString(sum[:]), modTime: time.Now()}
+		w.Header().Set("ETag", `"`+hex.EncodeToString(sum[:])+`"`)
+	case r.Method == "GET" || r.Method == "HEAD":
+		obj, ok := f.objects[key]
+		if !ok {
+			writeS3Error(w, http.StatusNotFound, "NoSuchKey")
+			return
+		}
+		w.Header().Set("ETag", `"`+obj.etag+`"`)
+		w.Header().Set("Last-Modified", obj.modTime.UTC().Format(http.TimeFormat))
+		w.Header().Set("Content-Length", strconv.Itoa(len(obj.data)))
+		if obj.partSize != "" {
+			w.Header().Set(partSizeMetaHeader, obj.partSize)
+		}
+		if r.Method == "GET" {
+			w.Write(obj.data)
+		}
+	case r.Method == "DELETE":
+		delete(f.objects, key)
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		writeS3Error(w, http.StatusMethodNotAllowed, "MethodNotAllowed")
+	}
+}
+
+func (f *fakeS3) list(w http.ResponseWriter, prefix string) {
+	var keys []string
+	for k := range f.objects {
+		if strings.HasPrefix(k, prefix) {
+			keys = append(keys, k)
+		}
+	}
+	sort.Strings(keys)
+	fmt.Fprint(w, "<ListBucketResult><IsTruncated>false</IsTruncated>")
+	for _, k := range keys {
+		fmt.Fprintf(w, "<Contents><Key>%s</Key><Size>%d</Size><LastModified>%s</LastModified></Contents>",
+			k, len(f.objects[k].data), f.objects[k].modTime.UTC().Format(time.RFC3339))
+	}
+	fmt.Fprint(w, "</ListBucketResult>")
+}
+
+func newTestS3Store(t *testing.T, endpoint string) *S3Store {
+	s, err := NewS3Store(config.S3StoreConfig{
+		Endpoint:        endpoint,
+		Region:          "us-east-1",
+		Bucket:          testBucket,
+		Prefix:          "/online/",
+		AccessKeyID:     testAccessKeyID,
+		SecretAccessKey: testSecretAccessKey,
+		PartSizeMB:      5,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Use tiny parts to exercise multipart uploads without large test data:
+	s.partSize = 10
+	return s
+}
+
+func TestS3Store(t *testing.T) {
+	fake := newFakeS3()
+	server := httptest.NewServer(fake)
+	defer server.Close()
+	s := newTestS3Store(t, server.URL)
+
+	small := Key{Cluster: "test cluster", Namespace: "small"}
+	large := Key{Cluster: "test cluster", Namespace: "large"}
+	exact := Key{Cluster: "test cluster", Namespace: "exact"}
+	other := Key{Cluster: "other cluster", Namespace: "small"}
+	contents := map[Key]string{
+		small: "tiny",
+		large: "a multipart archive spanning several parts",
+		exact: "0123456789abcdefghij",
+		other: "other",
+	}
+	for k, data := range contents {
+		if !assert.Nil(t, s.Put(k, bytes.NewBufferString(data)), k.String()) {
+			return
+		}
+	}
+	// Archives larger than a part are uploaded in parts, smaller ones with a single request:
+	assert.True(t, strings.HasSuffix(fake.objects["online/test cluster/large.tar.gz"].etag, "-5"))
+	assert.True(t, strings.HasSuffix(fake.objects["online/test cluster/exact.tar.gz"].etag, "-2"))
+	assert.Equal(t, "", fake.objects["online/test cluster/small.tar.gz"].partSize)
+
+	for k, expected := range contents {
+		r, err := s.Get(k)
+		if assert.Nil(t, err, k.String()) {
+			data, err := ioutil.ReadAll(r)
+			r.Close()
+			assert.Nil(t, err, k.String())
+			assert.Equal(t, expected, string(data))
+		}
+	}
+
+	info, err := s.Stat(large)
+	if assert.Nil(t, err) {
+		assert.Equal(t, int64(len(contents[large])), info.Size)
+	}
+
+	archives, err := s.List("test cluster")
+	if assert.Nil(t, err) {
+		assert.Equal(t, 3, len(archives))
+	}
+
+	assert.Nil(t, s.Delete(small))
+	_, err = s.Stat(small)
+	assert.Equal(t, ErrNotFound, err)
+	_, err = s.Get(small)
+	assert.Equal(t, ErrNotFound, err)
+	assert.Equal(t, ErrNotFound, s.Delete(small))
+}
+
+func TestS3StoreCorruptDownload(t *testing.T) {
+	fake := newFakeS3()
+	server := httptest.NewServer(fake)
+	defer server.Close()
+	s := newTestS3Store(t, server.URL)
+
+	for _, k := range []Key{
+		{Cluster: "test cluster", Namespace: "small"},
+		{Cluster: "test cluster", Namespace: "large"},
+	} {
+		if !assert.Nil(t, s.Put(k, bytes.NewBufferString(k.Namespace+" archive contents"))) {
+			return
+		}
+		fake.objects[s.objectKey(k)].data[0] = 'X'
+
+		r, err := s.Get(k)
+		if assert.Nil(t, err) {
+			_, err = ioutil.ReadAll(r)
+			r.Close()
+			if assert.NotNil(t, err, k.String()) {
+				assert.True(t, strings.Contains(err.Error(), "checksum mismatch"))
+			}
+		}
+	}
+}
+
+func TestS3StoreFailedMultipartUploadAborted(t *testing.T) {
+	fake := newFakeS3()
+	fake.failPart = 2
+	server := httptest.NewServer(fake)
+	defer server.Close()
+	s := newTestS3Store(t, server.URL)
+
+	key := Key{Cluster: "test cluster", Namespace: "large"}
+	assert.NotNil(t, s.Put(key, bytes.NewBufferString("a multipart archive spanning several parts")))
+	assert.Equal(t, 1, fake.aborted)
+	assert.Equal(t, 0, len(fake.uploads))
+	_, err := s.Stat(key)
+	assert.Equal(t, ErrNotFound, err)
+}
+
+func TestS3StoreBadCredentials(t *testing.T) {
+	server := httptest.NewServer(newFakeS3())
+	defer server.Close()
+	s := newTestS3Store(t, server.URL)
+	s.secretAccessKey = "wrong"
+
+	err := s.Put(Key{Cluster: "test cluster", Namespace: "small"}, bytes.NewBufferString("tiny"))
+	if assert.NotNil(t, err) {
+		assert.True(t, strings.Contains(err.Error(), "SignatureDoesNotMatch"))
+	}
+}
+
+func TestS3StoreTimeout(t *testing.T) {
+	release := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-release
+	}))
+	defer server.Close()
+	defer close(release)
+
+	s := newTestS3Store(t, server.URL)
+	s.client.Timeout = 50 * time.Millisecond
+	done := make(chan error)
+	go func() {
+		done <- s.Put(Key{Cluster: "cluster1", Namespace: "ns1"}, strings.NewReader("data"))
+	}()
+	select {
+	case err := <-done:
+		assert.NotNil(t, err)
+	case <-time.After(5 * time.Second):
+		t.Fatal("request to unresponsive server did not time out")
+	}
+}
+
+func TestETagHash(t *testing.T) {
+	data := []byte("0123456789abcdefghijklmnopqrstuvwxyz")
+	single := md5.Sum(data)
+
+	h := newETagHash(0)
+	h.Write(data)
+	assert.Equal(t, hex.EncodeToString(single[:]), h.Sum())
+
+	// Writes split across part boundaries must give the same result as one write:
+	h1 := newETagHash(10)
+	h1.Write(data)
+	h2 := newETagHash(10)
+	for i := range data {
+		h2.Write(data[i : i+1])
+	}
+	assert.Equal(t, h1.Sum(), h2.Sum())
+	assert.True(t, strings.HasSuffix(h1.Sum(), "-4"))
+}
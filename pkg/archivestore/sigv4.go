@@ -0,0 +1,89 @@
+package archivestore
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+)
+
+const (
+	sigV4Algorithm  = "AWS4-HMAC-SHA256"
+	amzDateFormat   = "20060102T150405Z"
+	sigV4Service    = "s3"
+	sigV4Terminator = "aws4_request"
+)
+
+// signRequest adds AWS signature version 4 authentication to a request. Every header already set on the request
+// is signed, along with the host.
+func signRequest(req *http.Request, accessKeyID, secretAccessKey, region, payloadHash string, t time.Time) {
+	amzDate := t.UTC().Format(amzDateFormat)
+	req.Header.Set("X-Amz-Date", amzDate)
+	req.Header.Set("X-Amz-Content-Sha256", payloadHash)
+
+	signedHeaders := []string{"host"}
+	for name := range req.Header {
+		signedHeaders = append(signedHeaders, strings.ToLower(name))
+	}
+	sort.Strings(signedHeaders)
+
+	signature := sigV4Signature(secretAccessKey, region, amzDate, req.Method, req.URL.Path, req.URL.Query(),
+		req.Header, req.URL.Host, signedHeaders, payloadHash)
+	req.Header.Set("Authorization", fmt.Sprintf("%s Credential=%s/%s, SignedHeaders=%s, Signature=%s",
+		sigV4Algorithm, accessKeyID, credentialScope(amzDate, region), strings.Join(signedHeaders, ";"), signature))
+}
+
+func credentialScope(amzDate, region string) string {
+	return strings.Join([]string{amzDate[:8], region, sigV4Service, sigV4Terminator}, "/")
+}
+
+// sigV4Signature computes the request signature from its decoded path and query.
+func sigV4Signature(secretAccessKey, region, amzDate, method, path string, query url.Values, header http.Header,
+	host string, signedHeaders []string, payloadHash string) string {
+
+	var canonicalHeaders []string
+	for _, name := range signedHeaders {
+		value := host
+		if name != "host" {
+			value = strings.Join(header[http.CanonicalHeaderKey(name)], ",")
+		}
+		canonicalHeaders = append(canonicalHeaders, name+":"+strings.TrimSpace(value)+"\n")
+	}
+	canonicalRequest := strings.Join([]string{
+		method,
+		uriEncode(path, false),
+		canonicalQuery(query),
+		strings.Join(canonicalHeaders, ""),
+		strings.Join(signedHeaders, ";"),
+		payloadHash,
+	}, "\n")
+
+	stringToSign := strings.Join([]string{
+		sigV4Algorithm,
+		amzDate,
+		credentialScope(amzDate, region),
+		sha256Hex([]byte(canonicalRequest)),
+	}, "\n")
+
+	key := hmacSHA256([]byte("AWS4"+secretAccessKey), amzDate[:8])
+	key = hmacSHA256(key, region)
+	key = hmacSHA256(key, sigV4Service)
+	key = hmacSHA256(key, sigV4Terminator)
+	return hex.EncodeToString(hmacSHA256(key, stringToSign))
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	h := hmac.New(sha256.New, key)
+	h.Write([]byte(data))
+	return h.Sum(nil)
+}
+
+func sha256Hex(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,264 @@
+package clustermonitor
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/openshift/online/archivist/pkg/activitystore"
+	"github.com/openshift/online/archivist/pkg/config"
+
+	buildclient "github.com/openshift/origin/pkg/build/client/clientset_generated/internalclientset/typed/core/internalversion"
+	oclient "github.com/openshift/origin/pkg/client"
+
+	kapi "k8s.io/kubernetes/pkg/api"
+	kcache "k8s.io/kubernetes/pkg/client/cache"
+	kclientset "k8s.io/kubernetes/pkg/client/clientset_generated/internalclientset"
+	"k8s.io/kubernetes/pkg/runtime"
+)
+
+// Activity is the most recent activity in a namespace found by an ActivitySource.
+type Activity struct {
+	Time time.Time
+	// Kind and Name identify the object responsible for the activity:
+	Kind string
+	Name string
+}
+
+// ActivitySource finds activity in namespaces, which is used to decide which namespaces are inactive and can be
+// archived. The last activity of a namespace is the most recent activity found by any enabled source.
+type ActivitySource interface {
+	// LastActivity returns the most recent activity in the namespace, with a zero time if there has been none.
+	LastActivity(namespace string) (Activity, error)
+	// Informers returns the informers the source reads from. They are run by the cluster monitor, and no capacity
+	// check is made until every informer has synced.
+	Informers() []NamedInformer
+	// Run starts any other processing the source needs, returning immediately. It must stop when stopChan is
+	// closed.
+	Run(stopChan <-chan struct{})
+}
+
+// NamedInformer is an informer along with the name of the resource it watches, used in logs and metrics.
+type NamedInformer struct {
+	Name     string
+	Informer kcache.SharedIndexInformer
+}
+
+// syncer is implemented by activity sources which must catch up on past activity after their informers have synced,
+// such as from a log file or informer events, so no capacity check is made until they have.
+type syncer interface {
+	HasSynced() bool
+}
+
+// namespaceForgetter is implemented by activity sources which hold the activity of each namespace, so it can be
+// dropped when the namespace is deleted.
+type namespaceForgetter interface {
+	forgetNamespace(namespace string)
+}
+
+// ActivitySourceContext holds the clients and configuration for the cluster an activity source is created for.
+type ActivitySourceContext struct {
+	ClusterConfig config.ClusterConfig
+	OC            oclient.Interface
+	KC            kclientset.Interface
+	BC            buildclient.CoreInterface
+	// Store persists activity as sources find it, nil if activity is not persisted.
+	Store *activitystore.ClusterStore
+}
+
+// ActivitySourceFactory creates an activity source for a cluster.
+type ActivitySourceFactory func(ctx ActivitySourceContext) (ActivitySource, error)
+
+type activitySourceRegistration struct {
+	factory          ActivitySourceFactory
+	enabledByDefault bool
+}
+
+var (
+	activitySourcesMutex sync.Mutex
+	activitySources      = map[string]activitySourceRegistration{}
+)
+
+// RegisterActivitySource makes an activity source available to be enabled in cluster configuration by name. Sources
+// enabled by default are used unless disabled in the configuration. It panics if the name is already registered.
+func RegisterActivitySource(name string, enabledByDefault bool, factory ActivitySourceFactory) {
+	activitySourcesMutex.Lock()
+	defer activitySourcesMutex.Unlock()
+	if _, exists := activitySources[name]; exists {
+		panic(fmt.Sprintf("activity source already registered: %s", name))
+	}
+	activitySources[name] = activitySourceRegistration{factory: factory, enabledByDefault: enabledByDefault}
+}
+
+// weightedSource is an activity source enabled for a cluster.
+type weightedSource struct {
+	name   string
+	source ActivitySource
+	weight float64
+}
+
+// newActivitySources creates every activity source enabled in the cluster configuration, ordered by name.
+func newActivitySources(ctx ActivitySourceContext) ([]weightedSource, error) {
+	activitySourcesMutex.Lock()
+	defer activitySourcesMutex.Unlock()
+
+	for name := range ctx.ClusterConfig.ActivitySources {
+		if _, ok := activitySources[name]; !ok {
+			return nil, fmt.Errorf("unknown activity source: %s", name)
+		}
+	}
+
+	names := make([]string, 0, len(activitySources))
+	for name := range activitySources {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	sources := []weightedSource{}
+	for _, name := range names {
+		reg := activitySources[name]
+		sourceCfg, configured := ctx.ClusterConfig.ActivitySources[name]
+		enabled := reg.enabledByDefault
+		if configured && sourceCfg.Enabled != nil {
+			enabled = *sourceCfg.Enabled
+		}
+		if !enabled {
+			continue
+		}
+		weight := 1.0
+		if configured && sourceCfg.Weight != 0 {
+			weight = sourceCfg.Weight
+		}
+		source, err := reg.factory(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("error creating activity source %s: %s", name, err)
+		}
+		sources = append(sources, weightedSource{name: name, source: source, weight: weight})
+	}
+	return sources, nil
+}
+
+// storeActivity persists activity found by the named source, if a store is configured.
+func storeActivity(store *activitystore.ClusterStore, source, namespace string, activity Activity) {
+	if store == nil || activity.Time.IsZero() {
+		return
+	}
+	store.Record(namespace, source, activitystore.Record{Time: activity.Time, Kind: activity.Kind, Name: activity.Name})
+}
+
+// weightActivity scales the time since the activity by the weight of its source, so activity from a source with a
+// weight of 2 appears half as old as it really is, and from a source with a weight of 0.5 twice as old.
+func weightActivity(activity time.Time, checkTime time.Time, weight float64) time.Time {
+	age := checkTime.Sub(activity)
+	if weight == 1 || age <= 0 {
+		return activity
+	}
+	return checkTime.Add(-time.Duration(float64(age) / weight))
+}
+
+// informerSource is an activity source for a single kind of object held in an informer. Rather than scanning every
+// object in a namespace for each capacity check, the most recent activity in each namespace is maintained as the
+// informer reports objects being added and updated. Deleting an object, e.g. when old builds are pruned, does not
+// remove its activity.
+//
+// Informers call event handlers asynchronously, possibly well after they have synced, so the source is only synced
+// once the activity of every object in the informer's initial list has been seen.
+type informerSource struct {
+	name     string
+	kind     string
+	informer kcache.SharedIndexInformer
+	// activity returns the most recent activity of an object, zero if there has been none:
+	activity func(obj interface{}) time.Time
+	store    *activitystore.ClusterStore
+
+	mutex sync.RWMutex
+	// latest holds the most recent activity in each namespace:
+	latest map[string]Activity
+	// seeded is set once latest holds the activity of every object listed when the informer synced:
+	seeded bool
+}
+
+// newInformerSource returns a source for the objects in the informer. If activity is persisted, the activity of
+// each object is also stored as it is added or updated.
+func newInformerSource(ctx ActivitySourceContext, name, kind string, informer kcache.SharedIndexInformer,
+	activity func(obj interface{}) time.Time) (*informerSource, error) {
+
+	s := &informerSource{
+		name:     name,
+		kind:     kind,
+		informer: informer,
+		activity: activity,
+		store:    ctx.Store,
+		latest:   map[string]Activity{},
+	}
+	err := informer.AddEventHandler(kcache.ResourceEventHandlerFuncs{
+		AddFunc: s.observe,
+		UpdateFunc: func(oldObj, newObj interface{}) {
+			s.observe(newObj)
+		},
+	})
+	if err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+func (s *informerSource) LastActivity(namespace string) (Activity, error) {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+	return s.latest[namespace], nil
+}
+
+func (s *informerSource) Informers() []NamedInformer {
+	return []NamedInformer{{Name: s.name, Informer: s.informer}}
+}
+
+func (s *informerSource) Run(stopChan <-chan struct{}) {}
+
+// HasSynced returns true once the informer has synced and the activity of the objects it listed has been seen. The
+// first call after the informer syncs observes every object in it rather than waiting for the event handlers, which
+// is safe as activity never moves backwards.
+func (s *informerSource) HasSynced() bool {
+	s.mutex.RLock()
+	seeded := s.seeded
+	s.mutex.RUnlock()
+	if seeded {
+		return true
+	}
+	if !s.informer.HasSynced() {
+		return false
+	}
+	for _, obj := range s.informer.GetIndexer().List() {
+		s.observe(obj)
+	}
+	s.mutex.Lock()
+	s.seeded = true
+	s.mutex.Unlock()
+	return true
+}
+
+func (s *informerSource) forgetNamespace(namespace string) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	delete(s.latest, namespace)
+}
+
+// observe updates the activity of the namespace of an object added or updated in the informer.
+func (s *informerSource) observe(obj interface{}) {
+	ts := s.activity(obj)
+	if ts.IsZero() {
+		return
+	}
+	objMeta, err := kapi.ObjectMetaFor(obj.(runtime.Object))
+	if err != nil {
+		return
+	}
+	activity := Activity{Time: ts, Kind: s.kind, Name: objMeta.Name}
+	storeActivity(s.store, s.name, objMeta.Namespace, activity)
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if ts.After(s.latest[objMeta.Namespace].Time) {
+		s.latest[objMeta.Namespace] = activity
+	}
+}
@@ -0,0 +1,133 @@
+package clustermonitor
+
+import (
+	"fmt"
+	"strconv"
+	"time"
+
+	log "github.com/Sirupsen/logrus"
+
+	kapi "k8s.io/kubernetes/pkg/api"
+)
+
+const (
+	// ExemptUntilAnnotation exempts a namespace from archival until the given date, in RFC 3339 or YYYY-MM-DD
+	// format. It may be set by namespace owners.
+	ExemptUntilAnnotation = "archivist.openshift.io/exempt-until"
+
+	// The following annotations are admin-only, and are only honoured if listed in the cluster's
+	// namespaceAnnotations adminAnnotations.
+
+	// MinInactiveDaysAnnotation overrides the cluster's minInactiveDays for a namespace.
+	MinInactiveDaysAnnotation = "archivist.openshift.io/min-inactive-days"
+	// MaxInactiveDaysAnnotation overrides the cluster's maxInactiveDays for a namespace.
+	MaxInactiveDaysAnnotation = "archivist.openshift.io/max-inactive-days"
+	// ArchiveImmediatelyAnnotation set to "true" archives a namespace at the next capacity check, regardless of its
+	// activity.
+	ArchiveImmediatelyAnnotation = "archivist.openshift.io/archive-immediately"
+)
+
+var adminAnnotations = []string{MinInactiveDaysAnnotation, MaxInactiveDaysAnnotation, ArchiveImmediatelyAnnotation}
+
+// validateAdminAnnotations checks that the admin annotations allowed for a cluster are known.
+func validateAdminAnnotations(allowed []string) error {
+	for _, annotation := range allowed {
+		if !stringInSlice(annotation, adminAnnotations) {
+			return fmt.Errorf("unknown admin annotation: %s", annotation)
+		}
+	}
+	return nil
+}
+
+// namespacePolicy is the archival policy for a single namespace, after applying its annotations.
+type namespacePolicy struct {
+	exemptUntil        time.Time
+	archiveImmediately bool
+	minInactive        time.Time
+	maxInactive        time.Time
+}
+
+// getNamespacePolicy returns the archival policy of a namespace at checkTime. Invalid or disallowed annotations are
+// logged and ignored.
+func (a *ClusterMonitor) getNamespacePolicy(namespace *kapi.Namespace, checkTime time.Time) namespacePolicy {
+	nsLog := log.WithFields(log.Fields{
+		"component": "capacitycheck",
+		"cluster":   a.clusterCfg.Name,
+		"namespace": namespace.Name,
+	})
+	cfg := a.clusterCfg.NamespaceAnnotations
+	annotation := func(name string) (string, bool) {
+		value, ok := namespace.Annotations[name]
+		if !ok {
+			return "", false
+		}
+		if name != ExemptUntilAnnotation && !stringInSlice(name, cfg.AdminAnnotations) {
+			nsLog.WithFields(log.Fields{"annotation": name}).Warnln("ignoring admin annotation not allowed for cluster")
+			return "", false
+		}
+		return value, true
+	}
+
+	var policy namespacePolicy
+	if value, ok := annotation(ExemptUntilAnnotation); ok {
+		exemptUntil, err := ParseExemptUntil(value)
+		if err != nil {
+			nsLog.WithFields(log.Fields{"annotation": ExemptUntilAnnotation}).Warnln(err)
+		} else if cfg.MaxExemptDays > 0 && exemptUntil.After(checkTime.AddDate(0, 0, cfg.MaxExemptDays)) {
+			nsLog.WithFields(log.Fields{
+				"annotation":    ExemptUntilAnnotation,
+				"exemptUntil":   exemptUntil,
+				"maxExemptDays": cfg.MaxExemptDays,
+			}).Warnln("ignoring exemption beyond max exempt time")
+		} else {
+			policy.exemptUntil = exemptUntil
+		}
+	}
+	if value, ok := annotation(ArchiveImmediatelyAnnotation); ok {
+		archiveImmediately, err := strconv.ParseBool(value)
+		if err != nil {
+			nsLog.WithFields(log.Fields{"annotation": ArchiveImmediatelyAnnotation}).Warnf("invalid value: %s", value)
+		}
+		policy.archiveImmediately = archiveImmediately
+	}
+
+	minInactiveDays := a.clusterCfg.MinInactiveDays
+	maxInactiveDays := a.clusterCfg.MaxInactiveDays
+	parseDays := func(name string, days *int) {
+		value, ok := annotation(name)
+		if !ok {
+			return
+		}
+		n, err := strconv.Atoi(value)
+		if err != nil || n <= 0 {
+			nsLog.WithFields(log.Fields{"annotation": name}).Warnf("invalid number of days: %s", value)
+			return
+		}
+		*days = n
+	}
+	parseDays(MinInactiveDaysAnnotation, &minInactiveDays)
+	parseDays(MaxInactiveDaysAnnotation, &maxInactiveDays)
+	if maxInactiveDays < minInactiveDays {
+		nsLog.WithFields(log.Fields{
+			"minInactiveDays": minInactiveDays,
+			"maxInactiveDays": maxInactiveDays,
+		}).Warnln("ignoring inactive days annotations, max inactive days cannot be less than min inactive days")
+		minInactiveDays = a.clusterCfg.MinInactiveDays
+		maxInactiveDays = a.clusterCfg.MaxInactiveDays
+	}
+	policy.minInactive = checkTime.AddDate(0, 0, -minInactiveDays)
+	policy.maxInactive = checkTime.AddDate(0, 0, -maxInactiveDays)
+	return policy
+}
+
+// ParseExemptUntil returns the end of the exemption given by the value of an ExemptUntilAnnotation.
+func ParseExemptUntil(value string) (time.Time, error) {
+	if t, err := time.Parse(time.RFC3339, value); err == nil {
+		return t, nil
+	}
+	if t, err := time.Parse("2006-01-02", value); err == nil {
+		// Exempt for the whole of the given day:
+		return t.AddDate(0, 0, 1), nil
+	}
+	return time.Time{}, fmt.Errorf("invalid exemption date: %s", value)
+}
@@ -0,0 +1,182 @@
+package clustermonitor
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/openshift/online/archivist/pkg/activitystore"
+	"github.com/openshift/online/archivist/pkg/config"
+	"github.com/openshift/online/archivist/pkg/tail"
+
+	log "github.com/Sirupsen/logrus"
+)
+
+// AuditLogActivitySource is the activity source for mutating API requests made by users, read from the API server
+// audit log. It is disabled by default, as the audit log must be available to the archivist.
+const AuditLogActivitySource = "auditlog"
+
+const auditLogPollInterval = time.Second
+
+// auditStageResponseComplete is the stage of the audit log entry written once the response to a request is sent.
+const auditStageResponseComplete = "ResponseComplete"
+
+// systemUserPrefix is the prefix of the names of users for cluster components and service accounts.
+const systemUserPrefix = "system:"
+
+// mutatingVerbs are the verbs of API requests which change the state of a namespace.
+var mutatingVerbs = map[string]bool{
+	"create":           true,
+	"update":           true,
+	"patch":            true,
+	"delete":           true,
+	"deletecollection": true,
+}
+
+func init() {
+	RegisterActivitySource(AuditLogActivitySource, false, func(ctx ActivitySourceContext) (ActivitySource, error) {
+		if ctx.ClusterConfig.AuditLog.Path == "" {
+			return nil, fmt.Errorf("auditLog path must be set")
+		}
+		return newAuditLogSource(ctx.ClusterConfig.Name, ctx.ClusterConfig.AuditLog, ctx.Store), nil
+	})
+}
+
+// auditEvent holds the fields of an audit log entry used to find activity. Both the audit.k8s.io v1alpha1 and
+// v1beta1 formats are supported.
+type auditEvent struct {
+	// Stage is set in v1beta1, which writes an entry for each stage of a request:
+	Stage string `json:"stage"`
+	Verb  string `json:"verb"`
+	User  struct {
+		Username string `json:"username"`
+	} `json:"user"`
+	ObjectRef *struct {
+		Resource  string `json:"resource"`
+		Namespace string `json:"namespace"`
+		Name      string `json:"name"`
+	} `json:"objectRef"`
+	ResponseStatus *struct {
+		Code int `json:"code"`
+	} `json:"responseStatus"`
+	// Timestamp is only set in v1alpha1, RequestReceivedTimestamp in v1beta1:
+	Timestamp                time.Time `json:"timestamp"`
+	RequestReceivedTimestamp time.Time `json:"requestReceivedTimestamp"`
+}
+
+// auditLogSource records the last mutating request made by a user in each namespace.
+type auditLogSource struct {
+	cfg          config.AuditLogConfig
+	ignoredUsers map[string]bool
+	store        *activitystore.ClusterStore
+	tailer       *tail.Tailer
+	log          *log.Entry
+
+	mutex        sync.RWMutex
+	lastActivity map[string]Activity
+}
+
+func newAuditLogSource(clusterName string, cfg config.AuditLogConfig,
+	store *activitystore.ClusterStore) *auditLogSource {
+
+	s := &auditLogSource{
+		cfg:          cfg,
+		ignoredUsers: map[string]bool{},
+		store:        store,
+		log: log.WithFields(log.Fields{
+			"cluster":   clusterName,
+			"component": logComponent,
+			"source":    AuditLogActivitySource,
+		}),
+		lastActivity: map[string]Activity{},
+	}
+	for _, user := range cfg.IgnoredUsers {
+		s.ignoredUsers[user] = true
+	}
+	s.tailer = tail.New(cfg.Path, auditLogPollInterval, s.handleLine)
+	return s
+}
+
+func (s *auditLogSource) LastActivity(namespace string) (Activity, error) {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+	return s.lastActivity[namespace], nil
+}
+
+func (s *auditLogSource) forgetNamespace(namespace string) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	delete(s.lastActivity, namespace)
+}
+
+func (s *auditLogSource) Informers() []NamedInformer {
+	return nil
+}
+
+// Run reads the whole audit log, then follows it as it is written.
+func (s *auditLogSource) Run(stopChan <-chan struct{}) {
+	go s.tailer.Run(stopChan)
+}
+
+// HasSynced returns true once the audit log has been read up to where it ended when the source was run.
+func (s *auditLogSource) HasSynced() bool {
+	return s.tailer.HasSynced()
+}
+
+func (s *auditLogSource) handleLine(line string) {
+	if strings.TrimSpace(line) == "" {
+		return
+	}
+	var event auditEvent
+	if err := json.Unmarshal([]byte(line), &event); err != nil {
+		s.log.Warnf("ignoring invalid audit log entry: %s", err)
+		return
+	}
+	namespace, activity, ok := s.userActivity(event)
+	if !ok {
+		return
+	}
+	storeActivity(s.store, AuditLogActivitySource, namespace, activity)
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if activity.Time.After(s.lastActivity[namespace].Time) {
+		s.lastActivity[namespace] = activity
+	}
+}
+
+// userActivity returns the namespace and activity for a successful mutating request made by a user, or false if
+// the request is not activity.
+func (s *auditLogSource) userActivity(event auditEvent) (string, Activity, bool) {
+	if !mutatingVerbs[event.Verb] || event.ObjectRef == nil {
+		return "", Activity{}, false
+	}
+	user := event.User.Username
+	if user == "" || strings.HasPrefix(user, systemUserPrefix) || s.ignoredUsers[user] {
+		return "", Activity{}, false
+	}
+	// Only requests which completed successfully changed anything. Entries for the earlier stages of a request have
+	// no response status:
+	if event.Stage != "" && event.Stage != auditStageResponseComplete {
+		return "", Activity{}, false
+	}
+	if event.ResponseStatus == nil || event.ResponseStatus.Code < 200 || event.ResponseStatus.Code >= 300 {
+		return "", Activity{}, false
+	}
+	namespace := event.ObjectRef.Namespace
+	if namespace == "" && (event.ObjectRef.Resource == "namespaces" || event.ObjectRef.Resource == "projects") {
+		namespace = event.ObjectRef.Name
+	}
+	if namespace == "" {
+		return "", Activity{}, false
+	}
+	activity := Activity{Time: event.RequestReceivedTimestamp, Kind: event.ObjectRef.Resource, Name: event.ObjectRef.Name}
+	if activity.Time.IsZero() {
+		activity.Time = event.Timestamp
+	}
+	if activity.Time.IsZero() {
+		return "", Activity{}, false
+	}
+	return namespace, activity, true
+}
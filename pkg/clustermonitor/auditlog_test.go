@@ -0,0 +1,128 @@
+package clustermonitor
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/openshift/online/archivist/pkg/config"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAuditLogActivity(t *testing.T) {
+	tests := []struct {
+		name     string
+		lines    []string
+		expected map[string]Activity
+	}{
+		{
+			name: "latest user request per namespace",
+			lines: []string{
+				`{"kind":"Event","apiVersion":"audit.k8s.io/v1beta1","stage":"ResponseComplete","verb":"create","user":{"username":"alice"},"objectRef":{"resource":"deploymentconfigs","namespace":"ns1","name":"frontend"},"responseStatus":{"code":201},"requestReceivedTimestamp":"2017-05-01T10:00:00Z"}`,
+				`{"kind":"Event","apiVersion":"audit.k8s.io/v1beta1","stage":"ResponseComplete","verb":"patch","user":{"username":"alice"},"objectRef":{"resource":"routes","namespace":"ns1","name":"www"},"responseStatus":{"code":200},"requestReceivedTimestamp":"2017-05-02T10:00:00Z"}`,
+				`{"kind":"Event","apiVersion":"audit.k8s.io/v1alpha1","verb":"delete","user":{"username":"bob"},"objectRef":{"resource":"pods","namespace":"ns2","name":"web-1"},"responseStatus":{"code":200},"timestamp":"2017-05-03T10:00:00Z"}`,
+				// Older entries do not replace newer:
+				`{"verb":"update","user":{"username":"alice"},"objectRef":{"resource":"services","namespace":"ns1","name":"web"},"responseStatus":{"code":200},"requestReceivedTimestamp":"2017-04-01T10:00:00Z"}`,
+			},
+			expected: map[string]Activity{
+				"ns1": {Time: time.Date(2017, time.May, 2, 10, 0, 0, 0, time.UTC), Kind: "routes", Name: "www"},
+				"ns2": {Time: time.Date(2017, time.May, 3, 10, 0, 0, 0, time.UTC), Kind: "pods", Name: "web-1"},
+			},
+		},
+		{
+			name: "project creation",
+			lines: []string{
+				`{"verb":"create","user":{"username":"alice"},"objectRef":{"resource":"namespaces","name":"ns1"},"responseStatus":{"code":201},"requestReceivedTimestamp":"2017-05-01T10:00:00Z"}`,
+			},
+			expected: map[string]Activity{
+				"ns1": {Time: time.Date(2017, time.May, 1, 10, 0, 0, 0, time.UTC), Kind: "namespaces", Name: "ns1"},
+			},
+		},
+		{
+			name: "ignored requests",
+			lines: []string{
+				"not json",
+				"",
+				// Reads:
+				`{"verb":"get","user":{"username":"alice"},"objectRef":{"resource":"pods","namespace":"ns1","name":"web-1"},"responseStatus":{"code":200},"requestReceivedTimestamp":"2017-05-01T10:00:00Z"}`,
+				// System users:
+				`{"verb":"update","user":{"username":"system:serviceaccount:ns1:deployer"},"objectRef":{"resource":"replicationcontrollers","namespace":"ns1","name":"web-1"},"responseStatus":{"code":200},"requestReceivedTimestamp":"2017-05-01T10:00:00Z"}`,
+				// Configured users:
+				`{"verb":"update","user":{"username":"robot"},"objectRef":{"resource":"configmaps","namespace":"ns1","name":"settings"},"responseStatus":{"code":200},"requestReceivedTimestamp":"2017-05-01T10:00:00Z"}`,
+				// Failed requests:
+				`{"verb":"delete","user":{"username":"alice"},"objectRef":{"resource":"pods","namespace":"ns1","name":"web-1"},"responseStatus":{"code":403},"requestReceivedTimestamp":"2017-05-01T10:00:00Z"}`,
+				// Cluster scoped resources:
+				`{"verb":"create","user":{"username":"alice"},"objectRef":{"resource":"persistentvolumes","name":"pv1"},"responseStatus":{"code":201},"requestReceivedTimestamp":"2017-05-01T10:00:00Z"}`,
+			},
+			expected: map[string]Activity{},
+		},
+		{
+			name: "request stages",
+			lines: []string{
+				// A forbidden request is logged when received, before its response status is known:
+				`{"kind":"Event","apiVersion":"audit.k8s.io/v1beta1","stage":"RequestReceived","verb":"delete","user":{"username":"alice"},"objectRef":{"resource":"pods","namespace":"ns1","name":"web-1"},"requestReceivedTimestamp":"2017-05-01T10:00:00Z"}`,
+				`{"kind":"Event","apiVersion":"audit.k8s.io/v1beta1","stage":"ResponseComplete","verb":"delete","user":{"username":"alice"},"objectRef":{"resource":"pods","namespace":"ns1","name":"web-1"},"responseStatus":{"code":403},"requestReceivedTimestamp":"2017-05-01T10:00:00Z"}`,
+				// Only the completion of a successful request is activity:
+				`{"kind":"Event","apiVersion":"audit.k8s.io/v1beta1","stage":"RequestReceived","verb":"create","user":{"username":"alice"},"objectRef":{"resource":"pods","namespace":"ns2","name":"web-1"},"requestReceivedTimestamp":"2017-05-02T10:00:00Z"}`,
+				`{"kind":"Event","apiVersion":"audit.k8s.io/v1beta1","stage":"ResponseComplete","verb":"create","user":{"username":"alice"},"objectRef":{"resource":"pods","namespace":"ns2","name":"web-1"},"responseStatus":{"code":201},"requestReceivedTimestamp":"2017-05-02T10:00:00Z"}`,
+			},
+			expected: map[string]Activity{
+				"ns2": {Time: time.Date(2017, time.May, 2, 10, 0, 0, 0, time.UTC), Kind: "pods", Name: "web-1"},
+			},
+		},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			cfg := config.AuditLogConfig{Path: "/unused", IgnoredUsers: []string{"robot"}}
+			s := newAuditLogSource("test cluster", cfg, nil)
+			for _, line := range tc.lines {
+				s.handleLine(line)
+			}
+			for ns, expected := range tc.expected {
+				activity, err := s.LastActivity(ns)
+				if assert.Nil(t, err) {
+					assert.Equal(t, expected.Kind, activity.Kind)
+					assert.Equal(t, expected.Name, activity.Name)
+					assert.True(t, expected.Time.Equal(activity.Time), "expected %s, got %s", expected.Time,
+						activity.Time)
+				}
+			}
+			assert.Equal(t, len(tc.expected), len(s.lastActivity))
+		})
+	}
+}
+
+func TestAuditLogSourceHasSynced(t *testing.T) {
+	dir, err := ioutil.TempDir("", "auditlog")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "audit.log")
+	entry := `{"verb":"create","user":{"username":"alice"},"objectRef":{"resource":"pods","namespace":"ns1","name":"web-1"},"responseStatus":{"code":201},"requestReceivedTimestamp":"2017-05-01T10:00:00Z"}` + "\n"
+	if err := ioutil.WriteFile(path, []byte(entry), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	s := newAuditLogSource("test cluster", config.AuditLogConfig{Path: path}, nil)
+	assert.False(t, s.HasSynced())
+	stopChan := make(chan struct{})
+	defer close(stopChan)
+	s.Run(stopChan)
+
+	deadline := time.Now().Add(5 * time.Second)
+	for !s.HasSynced() {
+		if time.Now().After(deadline) {
+			t.Fatal("timed out waiting for audit log to sync")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	// Activity already in the log has been found once synced:
+	activity, err := s.LastActivity("ns1")
+	if assert.Nil(t, err) {
+		assert.Equal(t, time.Date(2017, time.May, 1, 10, 0, 0, 0, time.UTC), activity.Time)
+	}
+}
@@ -3,13 +3,17 @@ package clustermonitor
 import (
 	"errors"
 	"fmt"
+	"github.com/openshift/online/archivist/pkg/activitystore"
 	"github.com/openshift/online/archivist/pkg/config"
+	"github.com/openshift/online/archivist/pkg/metrics"
+	"github.com/openshift/online/archivist/pkg/schedule"
 	"sort"
+	"strings"
+	"sync"
 	"time"
 
 	oclient "github.com/openshift/origin/pkg/client"
 
-	buildapi "github.com/openshift/origin/pkg/build/api"
 	buildclient "github.com/openshift/origin/pkg/build/client/clientset_generated/internalclientset/typed/core/internalversion"
 
 	// Prevents "no kind registered for version" even with generated clientset use
@@ -20,7 +24,6 @@ import (
 	kcache "k8s.io/kubernetes/pkg/client/cache"
 	kclientset "k8s.io/kubernetes/pkg/client/clientset_generated/internalclientset"
 	"k8s.io/kubernetes/pkg/runtime"
-	"k8s.io/kubernetes/pkg/util/wait"
 	"k8s.io/kubernetes/pkg/watch"
 
 	log "github.com/Sirupsen/logrus"
@@ -28,48 +31,41 @@ import (
 
 const logComponent = "clustermonitor"
 
+// NamespaceArchiver archives a namespace selected by the capacity check and removes it from the cluster.
+type NamespaceArchiver interface {
+	Archive(namespace *kapi.Namespace, lastActivity time.Time) error
+}
+
+// NewClusterMonitor creates a monitor for a cluster. If store is not nil, activity is persisted to it as it is found,
+// and namespaces keep the activity stored for them after the objects it was found from are deleted.
 func NewClusterMonitor(archivistConfig config.ArchivistConfig, clusterConfig config.ClusterConfig,
 	oc oclient.Interface, kc kclientset.Interface,
-	bc buildclient.CoreInterface) *ClusterMonitor {
+	bc buildclient.CoreInterface, archiver NamespaceArchiver,
+	store *activitystore.ClusterStore) (*ClusterMonitor, error) {
 
-	buildLW := &kcache.ListWatch{
-		ListFunc: func(options kapi.ListOptions) (runtime.Object, error) {
-			return bc.Builds(kapi.NamespaceAll).List(options)
-		},
-		WatchFunc: func(options kapi.ListOptions) (watch.Interface, error) {
-			return bc.Builds(kapi.NamespaceAll).Watch(options)
-		},
+	sched, err := schedule.New(clusterConfig.Schedule)
+	if err != nil {
+		return nil, fmt.Errorf("invalid schedule: %s", err)
 	}
 
-	// TODO: Currently targetting 1.5 but for 1.6, deads2k suggests switching to SharedInformerFactory from
-	// https://github.com/openshift/origin/blob/master/pkg/build/generated/informers/internalversion/factory.go#L29
-	// Then using .Build().Builds().AddResourceEventHandler()
-	buildInformer := kcache.NewSharedIndexInformer(
-		buildLW,
-		&buildapi.Build{},
-		0, // not currently doing any re-syncing
-		kcache.Indexers{
-			kcache.NamespaceIndex: kcache.MetaNamespaceIndexFunc,
-		},
-	)
-
-	rcLW := &kcache.ListWatch{
-		ListFunc: func(options kapi.ListOptions) (runtime.Object, error) {
-			return kc.Core().ReplicationControllers(kapi.NamespaceAll).List(options)
-		},
-		WatchFunc: func(options kapi.ListOptions) (watch.Interface, error) {
-			return kc.Core().ReplicationControllers(kapi.NamespaceAll).Watch(options)
-		},
+	if err := validateAdminAnnotations(clusterConfig.NamespaceAnnotations.AdminAnnotations); err != nil {
+		return nil, err
+	}
+	protection, err := newProtectionRules(clusterConfig)
+	if err != nil {
+		return nil, err
 	}
 
-	rcInformer := kcache.NewSharedIndexInformer(
-		rcLW,
-		&kapi.ReplicationController{},
-		0, // not currently doing any re-syncing
-		kcache.Indexers{
-			kcache.NamespaceIndex: kcache.MetaNamespaceIndexFunc,
-		},
-	)
+	sources, err := newActivitySources(ActivitySourceContext{
+		ClusterConfig: clusterConfig,
+		OC:            oc,
+		KC:            kc,
+		BC:            bc,
+		Store:         store,
+	})
+	if err != nil {
+		return nil, err
+	}
 
 	nsLW := &kcache.ListWatch{
 		ListFunc: func(options kapi.ListOptions) (runtime.Object, error) {
@@ -88,63 +84,348 @@ func NewClusterMonitor(archivistConfig config.ArchivistConfig, clusterConfig con
 		//kcache.NamespaceIndex: kcache.MetaNamespaceIndexFunc,
 		},
 	)
+	informers := []NamedInformer{{Name: "namespaces", Informer: nsInformer}}
+	for _, ws := range sources {
+		informers = append(informers, ws.source.Informers()...)
+	}
 	a := &ClusterMonitor{
-		cfg:           archivistConfig,
-		clusterCfg:    clusterConfig,
-		oc:            oc,
-		kc:            kc,
-		bc:            bc,
-		buildInformer: buildInformer,
-		rcInformer:    rcInformer,
-		nsInformer:    nsInformer,
-		buildIndexer:  buildInformer.GetIndexer(),
-		rcIndexer:     rcInformer.GetIndexer(),
-		nsIndexer:     nsInformer.GetIndexer(),
-	}
-	return a
+		cfg:        archivistConfig,
+		clusterCfg: clusterConfig,
+		oc:         oc,
+		kc:         kc,
+		bc:         bc,
+		archiver:   archiver,
+		nsInformer: nsInformer,
+		nsIndexer:  nsInformer.GetIndexer(),
+		sources:    sources,
+		informers:  informers,
+		protection: protection,
+		store:      store,
+		schedule:   sched,
+		now:        time.Now,
+		leading:    func() bool { return true },
+	}
+	a.hasSynced = a.HasSynced
+	if err := nsInformer.AddEventHandler(kcache.ResourceEventHandlerFuncs{DeleteFunc: a.namespaceDeleted}); err != nil {
+		return nil, err
+	}
+	// Report every informer as unsynced from the start, rather than only once it is first checked:
+	a.unsynced()
+	return a, nil
+}
+
+// namespaceDeleted forgets the activity of a deleted namespace, so it is not held forever.
+func (a *ClusterMonitor) namespaceDeleted(obj interface{}) {
+	if tombstone, ok := obj.(kcache.DeletedFinalStateUnknown); ok {
+		obj = tombstone.Obj
+	}
+	ns, ok := obj.(*kapi.Namespace)
+	if !ok {
+		return
+	}
+	for _, ws := range a.sources {
+		if f, ok := ws.source.(namespaceForgetter); ok {
+			f.forgetNamespace(ns.Name)
+		}
+	}
+	if a.store != nil {
+		a.store.Delete(ns.Name)
+	}
 }
 
 // ClusterMonitor monitors the state of the cluster and if necessary, evaluates namespace last activity to
 // determine which namespaces should be archived.
 type ClusterMonitor struct {
-	cfg          config.ArchivistConfig
-	clusterCfg   config.ClusterConfig
-	oc           oclient.Interface // TODO: not used
-	kc           kclientset.Interface
-	bc           buildclient.CoreInterface
-	stopChannel  <-chan struct{}
-	buildIndexer kcache.Indexer
-	rcIndexer    kcache.Indexer
-	nsIndexer    kcache.Indexer
+	cfg         config.ArchivistConfig
+	clusterCfg  config.ClusterConfig
+	oc          oclient.Interface
+	kc          kclientset.Interface
+	bc          buildclient.CoreInterface
+	archiver    NamespaceArchiver
+	stopChannel <-chan struct{}
+	nsIndexer   kcache.Indexer
+	// The enabled activity sources, ordered by name:
+	sources []weightedSource
+	// protection decides which namespaces can never be archived:
+	protection *protectionRules
 
 	// Avoid use in functions other than Run, the indexers are more testable:
-	buildInformer kcache.SharedIndexInformer
-	rcInformer    kcache.SharedIndexInformer
-	nsInformer    kcache.SharedIndexInformer
+	nsInformer kcache.SharedIndexInformer
+	// Every informer, including those of the activity sources:
+	informers []NamedInformer
+	// store persists activity, nil if activity is not persisted:
+	store *activitystore.ClusterStore
+
+	schedule *schedule.Schedule
+	// now returns the current time, and hasSynced whether every informer and activity source has synced, replaced
+	// in tests:
+	now       func() time.Time
+	hasSynced func() bool
+	// leading returns whether this replica may archive, always true without leader election:
+	leading func() bool
+
+	// Guards the times below, which are read by health checks:
+	mutex sync.Mutex
+	// started is when Run was called, lastCheck when the last capacity check completed, and lastProgress when the
+	// current check last archived a namespace successfully:
+	started      time.Time
+	lastCheck    time.Time
+	lastProgress time.Time
 }
 
-func (a *ClusterMonitor) Run(stopChan <-chan struct{}) {
+// Run starts the informers and blocks until their caches have synced, then starts the periodic capacity checks.
+// An error is returned if the caches do not sync within the configured timeout, in which case no capacity checks
+// are run and the caller should close stopChan to stop the informers. If stopChan is closed while waiting, Run
+// returns nil.
+func (a *ClusterMonitor) Run(stopChan <-chan struct{}) error {
+	a.mutex.Lock()
+	a.started = a.now()
+	a.mutex.Unlock()
 	a.stopChannel = stopChan
-	go a.buildInformer.Run(a.stopChannel)
-	go a.rcInformer.Run(a.stopChannel)
-	go a.nsInformer.Run(a.stopChannel)
+	for _, i := range a.informers {
+		go i.Informer.Run(a.stopChannel)
+	}
+	for _, ws := range a.sources {
+		ws.source.Run(a.stopChannel)
+	}
+
+	clusterLog := log.WithFields(log.Fields{"cluster": a.clusterCfg.Name, "component": logComponent})
+	clusterLog.WithFields(log.Fields{"timeout": a.cfg.CacheSyncTimeout}).Infoln("waiting for caches to sync")
+	if err := a.waitForCacheSync(); err != nil {
+		return err
+	}
+	select {
+	case <-a.stopChannel:
+		return nil
+	default:
+	}
+	clusterLog.Infoln("caches synced")
 
-	// TODO: configurable duration
-	go wait.Until(a.checkCapacity, 5*time.Minute, a.stopChannel)
+	go a.runChecks()
 
-	// Rather than wait a complete interval, give the informers some time to receive lists of API objects, then
-	// do a capacity check:
-	time.Sleep(500 * time.Millisecond)
-	go a.checkCapacity()
+	clusterLog.Infoln("clustermonitor is running")
+	return nil
+}
+
+// runChecks runs capacity checks as scheduled until the monitor is stopped.
+func (a *ClusterMonitor) runChecks() {
+	next := a.schedule.First(a.now())
+	for {
+		log.WithFields(log.Fields{"component": logComponent, "cluster": a.clusterCfg.Name, "nextCheck": next}).Debugln(
+			"scheduled capacity check")
+		select {
+		case <-a.stopChannel:
+			return
+		case <-time.After(next.Sub(a.now())):
+		}
+		a.checkCapacity()
+		next = a.schedule.Next(next)
+		// Skip any checks missed while this one was running:
+		if now := a.now(); next.Before(now) {
+			next = a.schedule.Next(now)
+		}
+	}
+}
+
+// waitForCacheSync waits for every informer and activity source to sync, until the cache sync timeout expires or
+// the monitor is stopped.
+func (a *ClusterMonitor) waitForCacheSync() error {
+	syncStop := make(chan struct{})
+	waitDone := make(chan struct{})
+	defer close(waitDone)
+	go func() {
+		select {
+		case <-a.stopChannel:
+		case <-time.After(a.cfg.CacheSyncTimeout):
+		case <-waitDone:
+			return
+		}
+		close(syncStop)
+	}()
+
+	if kcache.WaitForCacheSync(syncStop, a.HasSynced) {
+		return nil
+	}
+	select {
+	case <-a.stopChannel:
+		return nil
+	default:
+	}
+	return fmt.Errorf("timed out after %s waiting for caches to sync: %s", a.cfg.CacheSyncTimeout,
+		strings.Join(a.unsynced(), ", "))
+}
+
+// HasSynced returns true once every informer has completed its initial list of API objects, and every activity
+// source has caught up.
+func (a *ClusterMonitor) HasSynced() bool {
+	return len(a.unsynced()) == 0
+}
+
+// unsynced returns the names of the informers and activity sources which have not synced. As it is polled while
+// waiting for the caches to sync and by readiness checks, it also records whether each has synced in metrics.
+func (a *ClusterMonitor) unsynced() []string {
+	unsynced := []string{}
+	for _, i := range a.informers {
+		synced := i.Informer.HasSynced()
+		metrics.SetInformerSynced(a.clusterCfg.Name, i.Name, synced)
+		if !synced {
+			unsynced = append(unsynced, i.Name)
+		}
+	}
+	for _, ws := range a.sources {
+		if s, ok := ws.source.(syncer); ok {
+			synced := s.HasSynced()
+			metrics.SetInformerSynced(a.clusterCfg.Name, ws.name, synced)
+			if !synced {
+				unsynced = append(unsynced, ws.name)
+			}
+		}
+	}
+	return unsynced
+}
+
+// Healthy returns an error if no capacity check has completed or made progress archiving within the configured
+// number of scheduled checks, counted from the last completed check or archived namespace or, if there has been
+// neither, from when the monitor was started. A long archival batch is therefore healthy while it makes progress.
+func (a *ClusterMonitor) Healthy(now time.Time) error {
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+	since := a.lastCheck
+	if a.lastProgress.After(since) {
+		since = a.lastProgress
+	}
+	if since.IsZero() {
+		since = a.started
+	}
+	if since.IsZero() {
+		// Not running yet:
+		return nil
+	}
+	deadline := since
+	for i := 0; i < a.cfg.LivenessCheckMultiplier; i++ {
+		deadline = a.schedule.Next(deadline)
+	}
+	if now.After(deadline) {
+		if a.lastCheck.IsZero() {
+			return fmt.Errorf("no capacity check completed since monitor started at %s", since)
+		}
+		return fmt.Errorf("no capacity check completed since %s", since)
+	}
+	return nil
+}
 
-	log.Infoln("clustermonitor is running")
+// SetLeading makes the monitor only check capacity and archive while leading returns true, for replicas running
+// with leader election. The monitor keeps tracking and persisting activity while not leading, so a replica which
+// becomes leader already knows of everything the previous leader saw. Must be called before Run.
+func (a *ClusterMonitor) SetLeading(leading func() bool) {
+	a.leading = leading
 }
 
 // checkCapacity checks the capacity by all configured metrics and determines what (if any) namespaces need to
 // be archived.
 func (a *ClusterMonitor) checkCapacity() {
-	a.getNamespacesToArchive(time.Now())
-	// TODO: trigger actual archival for each namespace here
+	// A namespace whose workloads have not been listed yet would appear inactive, so never make archival
+	// decisions from partially synced caches. The check is not counted as completed for liveness:
+	if !a.hasSynced() {
+		log.WithFields(log.Fields{"component": logComponent, "cluster": a.clusterCfg.Name}).Errorln(
+			"caches not synced, skipping capacity check")
+		return
+	}
+	// A replica on standby has nothing to check, but is as live as its leader:
+	if !a.leading() {
+		log.WithFields(log.Fields{"component": logComponent, "cluster": a.clusterCfg.Name}).Debugln(
+			"not leader, skipping capacity check")
+		a.mutex.Lock()
+		a.lastCheck = a.now()
+		a.mutex.Unlock()
+		return
+	}
+
+	start := time.Now()
+	defer func() {
+		metrics.CapacityCheckDuration.WithLabelValues(a.clusterCfg.Name).Observe(time.Since(start).Seconds())
+		a.mutex.Lock()
+		a.lastCheck = a.now()
+		a.mutex.Unlock()
+	}()
+
+	namespaces, err := a.getNamespacesToArchive(a.now())
+	if err != nil {
+		log.WithFields(log.Fields{"component": logComponent, "cluster": a.clusterCfg.Name}).Errorf(
+			"error calculating namespaces to archive: %s", err)
+		return
+	}
+	a.archiveNamespaces(namespaces)
+}
+
+// archiveNamespaces archives each namespace in turn. A failure to archive one namespace is logged and
+// does not prevent archival of the rest. In dry run mode the namespaces are only logged. Archival stops if the
+// cluster is outside its maintenance windows, the remaining namespaces will be selected again by a later check, and
+// is abandoned if the monitor is stopped or leadership is lost.
+func (a *ClusterMonitor) archiveNamespaces(namespaces []LastActivity) {
+	archived := 0
+	for i, la := range namespaces {
+		if !a.schedule.InMaintenanceWindow(a.now()) {
+			log.WithFields(log.Fields{
+				"component": logComponent,
+				"cluster":   a.clusterCfg.Name,
+				"deferred":  len(namespaces) - i,
+			}).Infoln("outside maintenance windows, deferring archival")
+			namespaces = namespaces[:i]
+			break
+		}
+		nsLog := log.WithFields(log.Fields{
+			"namespace":    la.Namespace.Name,
+			"lastActivity": la.Time,
+			"cluster":      a.clusterCfg.Name,
+			"component":    logComponent,
+		})
+		if a.cfg.DryRun {
+			nsLog.Infoln("dry run, would archive namespace")
+			continue
+		}
+		select {
+		case <-a.stopChannel:
+			log.WithFields(log.Fields{
+				"component": logComponent,
+				"cluster":   a.clusterCfg.Name,
+				"deferred":  len(namespaces) - i,
+			}).Warnln("monitor stopped, abandoning archival")
+			return
+		default:
+		}
+		// Another replica may now be archiving:
+		if !a.leading() {
+			log.WithFields(log.Fields{
+				"component": logComponent,
+				"cluster":   a.clusterCfg.Name,
+				"deferred":  len(namespaces) - i,
+			}).Warnln("leadership lost, abandoning archival")
+			return
+		}
+		if err := a.archiver.Archive(la.Namespace, la.Time); err != nil {
+			nsLog.Errorf("error archiving namespace: %s", err)
+			continue
+		}
+		archived++
+		a.mutex.Lock()
+		a.lastProgress = a.now()
+		a.mutex.Unlock()
+	}
+	if a.cfg.DryRun {
+		log.WithFields(log.Fields{
+			"component":       logComponent,
+			"cluster":         a.clusterCfg.Name,
+			"wouldBeArchived": len(namespaces),
+		}).Infoln("dry run complete, no namespaces archived")
+		return
+	}
+	log.WithFields(log.Fields{
+		"component": logComponent,
+		"cluster":   a.clusterCfg.Name,
+		"archived":  archived,
+		"failed":    len(namespaces) - archived,
+	}).Infoln("archival complete")
 }
 
 type LastActivity struct {
@@ -158,10 +439,57 @@ func (a LastActivitySorter) Len() int           { return len(a) }
 func (a LastActivitySorter) Swap(i, j int)      { a[i], a[j] = a[j], a[i] }
 func (a LastActivitySorter) Less(i, j int) bool { return a[i].Time.Before(a[j].Time) }
 
+// isProtected returns true if the named namespace can never be archived. Rules on labels and annotations are only
+// applied if the namespace is in the cache.
+func (a *ClusterMonitor) isProtected(name string) bool {
+	if obj, exists, err := a.nsIndexer.GetByKey(name); err == nil && exists {
+		_, ok := a.protection.protected(obj.(*kapi.Namespace))
+		return ok
+	}
+	_, ok := a.protection.protectedName(name)
+	return ok
+}
+
+// emptyNamespaceActivity applies the empty namespace policy to a namespace in which no activity has been found. It
+// returns the time to use as the namespace's last activity, zero if the namespace should not be archived, and true if
+// the namespace is over the maximum empty time and must be archived. As that archives the namespace regardless of
+// capacity, the maximum empty time only applies once every source has synced, so activity which has not been seen
+// yet is never taken for an empty namespace.
+func (a *ClusterMonitor) emptyNamespaceActivity(namespace *kapi.Namespace, checkTime time.Time,
+	synced bool) (time.Time, bool) {
+
+	policy := a.clusterCfg.EmptyNamespaces
+	created := namespace.CreationTimestamp.Time
+	nsLog := log.WithFields(log.Fields{
+		"component": "capacitycheck",
+		"cluster":   a.clusterCfg.Name,
+		"namespace": namespace.Name,
+		"created":   created,
+	})
+	if created.IsZero() || (!policy.UseCreationTime && policy.MaxEmptyDays == 0) {
+		nsLog.Warnln("no last activity time calculated for namespace")
+		return time.Time{}, false
+	}
+	if policy.MaxEmptyDays > 0 && !synced {
+		nsLog.Warnln("activity sources not synced, not applying max empty time")
+	} else if policy.MaxEmptyDays > 0 && created.Before(checkTime.AddDate(0, 0, -policy.MaxEmptyDays)) {
+		nsLog.WithFields(log.Fields{"maxEmptyDays": policy.MaxEmptyDays}).Infoln(
+			"found empty namespace over max empty time")
+		return created, true
+	}
+	if !policy.UseCreationTime {
+		nsLog.Debugln("empty namespace within max empty time")
+		return time.Time{}, false
+	}
+	nsLog.Debugln("using creation time as last activity of empty namespace")
+	return created, false
+}
+
 func (a *ClusterMonitor) getNamespacesToArchive(checkTime time.Time) ([]LastActivity, error) {
 
 	capLog := log.WithFields(log.Fields{
 		"component": "capacitycheck",
+		"cluster":   a.clusterCfg.Name,
 	})
 	if a.clusterCfg.NamespaceCapacity.HighWatermark == 0 {
 		capLog.Warnln("no namespace capacity high watermark defined, skipping")
@@ -181,6 +509,7 @@ func (a *ClusterMonitor) getNamespacesToArchive(checkTime time.Time) ([]LastActi
 	somewhatInactive := make([]LastActivity, 0, 20) // may be archived if we need room
 
 	// Calculate last activity time for all namespaces and sort it:
+	synced := a.hasSynced()
 
 	//namespaceCount := len(namespaces)
 	namespaces := a.nsIndexer.List()
@@ -194,33 +523,56 @@ func (a *ClusterMonitor) getNamespacesToArchive(checkTime time.Time) ([]LastActi
 
 	for _, pt := range namespaces {
 		namespace := pt.(*kapi.Namespace)
-		if stringInSlice(namespace.Name, a.clusterCfg.ProtectedNamespaces) {
-			capLog.WithFields(log.Fields{"namespace": namespace.Name}).Debugln("skipping protected namespace")
+		if rule, ok := a.protection.protected(namespace); ok {
+			capLog.WithFields(log.Fields{"namespace": namespace.Name, "rule": rule}).Debugln("skipping protected namespace")
+			continue
+		}
+		policy := a.getNamespacePolicy(namespace, checkTime)
+		if checkTime.Before(policy.exemptUntil) {
+			capLog.WithFields(log.Fields{
+				"namespace":   namespace.Name,
+				"exemptUntil": policy.exemptUntil,
+			}).Debugln("skipping exempt namespace")
 			continue
 		}
-		lastActivity, err := a.getLastActivity(namespace.Name)
+		lastActivity, err := a.getLastActivity(namespace.Name, checkTime)
 		if err != nil {
 			return []LastActivity{}, err
 		}
-		if lastActivity.IsZero() {
-			capLog.WithFields(log.Fields{"namespace": namespace.Name}).Warnln("no last activity time calculated for namespace")
+		if policy.archiveImmediately {
+			capLog.WithFields(log.Fields{
+				"namespace":    namespace.Name,
+				"lastActivity": lastActivity,
+			}).Infoln("found namespace marked for immediate archival")
+			veryInactive = append(veryInactive, LastActivity{namespace, lastActivity})
 			continue
 		}
-		if lastActivity.Before(maxInactive) {
+		if lastActivity.IsZero() {
+			var veryInactiveEmpty bool
+			lastActivity, veryInactiveEmpty = a.emptyNamespaceActivity(namespace, checkTime, synced)
+			if veryInactiveEmpty {
+				veryInactive = append(veryInactive, LastActivity{namespace, lastActivity})
+				continue
+			}
+			if lastActivity.IsZero() {
+				continue
+			}
+		}
+		if lastActivity.Before(policy.maxInactive) {
 			capLog.WithFields(log.Fields{
 				"namespace":    namespace.Name,
 				"lastActivity": lastActivity,
 				"checkTime":    checkTime,
-				"maxInactive":  maxInactive,
+				"maxInactive":  policy.maxInactive,
 			}).Infoln("found namespace over max inactive time")
 			veryInactive = append(veryInactive, LastActivity{namespace, lastActivity})
-		} else if lastActivity.Before(minInactive) {
+		} else if lastActivity.Before(policy.minInactive) {
 			capLog.WithFields(log.Fields{
 				"namespace":    namespace.Name,
 				"lastActivity": lastActivity,
 				"checkTime":    checkTime,
-				"minInactive":  minInactive,
-				"maxInactive":  maxInactive,
+				"minInactive":  policy.minInactive,
+				"maxInactive":  policy.maxInactive,
 			}).Infoln("found namespace between max/min inactive times")
 			somewhatInactive = append(somewhatInactive, LastActivity{namespace, lastActivity})
 		}
@@ -230,6 +582,9 @@ func (a *ClusterMonitor) getNamespacesToArchive(checkTime time.Time) ([]LastActi
 		"veryInactive":     len(veryInactive),
 		"somewhatInactive": len(somewhatInactive),
 	}).Infoln("last activity totals")
+	metrics.Namespaces.WithLabelValues(a.clusterCfg.Name).Set(float64(len(namespaces)))
+	metrics.VeryInactiveNamespaces.WithLabelValues(a.clusterCfg.Name).Set(float64(len(veryInactive)))
+	metrics.SomewhatInactiveNamespaces.WithLabelValues(a.clusterCfg.Name).Set(float64(len(somewhatInactive)))
 
 	namespacesToArchive := make([]LastActivity, len(veryInactive), (cap(veryInactive)+1)*2)
 	copy(namespacesToArchive, veryInactive)
@@ -262,7 +617,9 @@ func (a *ClusterMonitor) getNamespacesToArchive(checkTime time.Time) ([]LastActi
 	for _, ap := range namespacesToArchive {
 		capLog.Infoln("archiving:", ap.Namespace.Name)
 	}
+	metrics.SelectedNamespaces.WithLabelValues(a.clusterCfg.Name).Set(float64(len(namespacesToArchive)))
 	newNSCount = len(namespaces) - len(namespacesToArchive)
+	metrics.SetLowWatermarkReachable(a.clusterCfg.Name, newNSCount <= a.clusterCfg.NamespaceCapacity.LowWatermark)
 	if newNSCount > a.clusterCfg.NamespaceCapacity.LowWatermark {
 		capLog.WithFields(log.Fields{
 			"lowWatermark": a.clusterCfg.NamespaceCapacity.LowWatermark,
@@ -274,8 +631,8 @@ func (a *ClusterMonitor) getNamespacesToArchive(checkTime time.Time) ([]LastActi
 
 }
 
-// GetLastActivity returns the last activity time for a namespace by examining it's builds and replication controllers.
-// If no builds or replication controllers are found we return nil. If the namespace does not exist, we return an error.
+// GetLastActivity returns the last activity time for a namespace from all enabled activity sources. If no
+// activity is found we return the zero time. If the namespace does not exist, we return an error.
 func (a *ClusterMonitor) GetLastActivity(namespace string) (time.Time, error) {
 	// return an error if the namespace doesn't exist
 	_, exists, err := a.nsInformer.GetIndexer().GetByKey(namespace)
@@ -286,7 +643,7 @@ func (a *ClusterMonitor) GetLastActivity(namespace string) (time.Time, error) {
 		return time.Time{}, errors.New(fmt.Sprintf("namespace does not exist in cache: %s", namespace))
 	}
 
-	tm, err := a.getLastActivity(namespace)
+	tm, err := a.getLastActivity(namespace, a.now())
 	return tm, err
 }
 
@@ -299,70 +656,46 @@ func stringInSlice(a string, list []string) bool {
 	return false
 }
 
-func (a *ClusterMonitor) getLastActivity(namespace string) (time.Time, error) {
+// getLastActivity returns the most recent activity found by any enabled activity source, after weighting the
+// activity from each source relative to checkTime.
+func (a *ClusterMonitor) getLastActivity(namespace string, checkTime time.Time) (time.Time, error) {
 
 	nsLog := log.WithFields(log.Fields{
 		"namespace": namespace,
+		"cluster":   a.clusterCfg.Name,
 		"component": logComponent,
 	})
 
 	// Not necessarily a problem here, but worth warning about:
-	if stringInSlice(namespace, a.clusterCfg.ProtectedNamespaces) {
+	if a.isProtected(namespace) {
 		nsLog.Warnln("called getLastActivity for protected namespace")
 	}
 
 	var lastActivity time.Time
-
-	builds, err := a.buildIndexer.ByIndex(kcache.NamespaceIndex, namespace)
-	if err != nil {
-		return time.Time{}, err
-	}
-	rcs, err := a.rcIndexer.ByIndex(kcache.NamespaceIndex, namespace)
-	if err != nil {
-		return time.Time{}, err
-	}
-	nsLog.WithFields(log.Fields{"builds": len(builds), "rcs": len(rcs)}).Debugln(
-		"calculating last activity time")
-
-	for _, obj := range builds {
-		b := obj.(*buildapi.Build)
-		// Build may briefly have no start timestamp, ignore it:
-		if b.Status.StartTimestamp == nil {
-			nsLog.WithFields(log.Fields{
-				"namespace": namespace,
-				"name":      b.Name,
-				"kind":      "Build",
-			}).Debugln("skipping build with no start time")
-			continue
+	for _, ws := range a.sources {
+		activity, err := ws.source.LastActivity(namespace)
+		if err != nil {
+			return time.Time{}, fmt.Errorf("error getting activity from %s: %s", ws.name, err)
 		}
-		ts := b.Status.StartTimestamp
-		if lastActivity.IsZero() || ts.Time.After(lastActivity) {
-			lastActivity = ts.Time
-			nsLog.WithFields(log.Fields{
-				"lastActivity": lastActivity,
-				"kind":         "Build",
-				"name":         b.Name,
-			}).Debugln("updating last activity time")
+		// Activity found earlier may no longer be visible to the source, e.g. after builds are pruned:
+		if a.store != nil {
+			if stored := a.store.Get(namespace, ws.name); stored.Time.After(activity.Time) {
+				activity = Activity{Time: stored.Time, Kind: stored.Kind, Name: stored.Name}
+			}
 		}
-	}
-
-	for _, obj := range rcs {
-		r := obj.(*kapi.ReplicationController)
-		if r.ObjectMeta.CreationTimestamp.Time == (time.Time{}) {
-			nsLog.WithFields(log.Fields{
-				"name": r.Name,
-				"kind": "ReplicationController",
-			}).Debugln("skipping RC with no start time")
+		if activity.Time.IsZero() {
 			continue
 		}
-		ts := &r.ObjectMeta.CreationTimestamp
-		if lastActivity.IsZero() || ts.Time.After(lastActivity) {
-			lastActivity = ts.Time
+		weighted := weightActivity(activity.Time, checkTime, ws.weight)
+		if lastActivity.IsZero() || weighted.After(lastActivity) {
+			lastActivity = weighted
 			nsLog.WithFields(log.Fields{
 				"lastActivity": lastActivity,
-				"kind":         "ReplicationController",
-				"name":         r.Name,
-			}).Debugln("updating namespace in cache")
+				"activityTime": activity.Time,
+				"source":       ws.name,
+				"kind":         activity.Kind,
+				"name":         activity.Name,
+			}).Debugln("updating last activity time")
 		}
 	}
 
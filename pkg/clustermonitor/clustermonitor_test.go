@@ -1,20 +1,30 @@
 package clustermonitor
 
 import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
 	"testing"
 	"time"
 
+	"github.com/openshift/online/archivist/pkg/activitystore"
 	"github.com/openshift/online/archivist/pkg/config"
 
 	buildapi "github.com/openshift/origin/pkg/build/api"
 	fakebuildclient "github.com/openshift/origin/pkg/build/client/clientset_generated/internalclientset/fake"
 	otestclient "github.com/openshift/origin/pkg/client/testclient"
+	deployapi "github.com/openshift/origin/pkg/deploy/api"
+	imageapi "github.com/openshift/origin/pkg/image/api"
 
 	kapi "k8s.io/kubernetes/pkg/api"
 	kunversioned "k8s.io/kubernetes/pkg/api/unversioned"
+	"k8s.io/kubernetes/pkg/apis/apps"
+	"k8s.io/kubernetes/pkg/apis/batch"
+	"k8s.io/kubernetes/pkg/apis/extensions"
 	kcache "k8s.io/kubernetes/pkg/client/cache"
 	ktestclient "k8s.io/kubernetes/pkg/client/clientset_generated/internalclientset/fake"
 
+	"errors"
 	"fmt"
 	log "github.com/Sirupsen/logrus"
 	"github.com/stretchr/testify/assert"
@@ -31,6 +41,26 @@ type NamespaceTestData struct {
 	expectedLastActivity time.Time
 }
 
+// sourceObjects returns a store for adding objects to an informer based activity source, as if they had been
+// reported by its informer. The informers are never run in tests.
+func sourceObjects(cm *ClusterMonitor, sourceName string) *fakeSourceStore {
+	for _, ws := range cm.sources {
+		if ws.name == sourceName {
+			return &fakeSourceStore{source: ws.source.(*informerSource)}
+		}
+	}
+	panic("no such activity source: " + sourceName)
+}
+
+type fakeSourceStore struct {
+	source *informerSource
+}
+
+func (f *fakeSourceStore) Add(obj interface{}) error {
+	f.source.observe(obj)
+	return nil
+}
+
 func fakeNamespace(name string) *kapi.Namespace {
 	p := kapi.Namespace{
 		ObjectMeta: kapi.ObjectMeta{
@@ -201,33 +231,30 @@ func TestNamespaceLastActivity(t *testing.T) {
 			kc := &ktestclient.Clientset{}
 
 			aConfig := config.NewDefaultArchivistConfig()
-			cm := NewClusterMonitor(aConfig, aConfig.Clusters[0], oc, kc, bc.Core())
+			cm, err := NewClusterMonitor(aConfig, aConfig.Clusters[0], oc, kc, bc.Core(), nil, nil)
+			if !assert.Nil(t, err) {
+				return
+			}
 
-			// Building our indexers to bypass the Informer framework, which is more
+			// Adding objects directly to bypass the Informer framework, which is more
 			// complicated to test and looks to involve sleeping until the informer
 			// threads can run with the given testdata:
-			cm.buildIndexer = kcache.NewIndexer(kcache.MetaNamespaceKeyFunc,
-				kcache.Indexers{
-					kcache.NamespaceIndex: kcache.MetaNamespaceIndexFunc,
-				})
-			cm.rcIndexer = kcache.NewIndexer(kcache.MetaNamespaceKeyFunc,
-				kcache.Indexers{
-					kcache.NamespaceIndex: kcache.MetaNamespaceIndexFunc,
-				})
+			buildIndexer := sourceObjects(cm, BuildsActivitySource)
+			rcIndexer := sourceObjects(cm, ReplicationControllersActivitySource)
 
 			// Add all test data to the cluster monitor first:
 			for _, p := range tc.namespaces {
 				for i := range p.builds {
-					cm.buildIndexer.Add(p.builds[i])
+					buildIndexer.Add(p.builds[i])
 				}
 				for i := range p.rcs {
-					cm.rcIndexer.Add(p.rcs[i])
+					rcIndexer.Add(p.rcs[i])
 				}
 			}
 
 			// Run through again for the actual testing:
 			for _, p := range tc.namespaces {
-				ts, err := cm.getLastActivity(p.name)
+				ts, err := cm.getLastActivity(p.name, tm(2017, time.May, 29))
 				if assert.Nil(t, err) {
 					assert.Equal(t, p.expectedLastActivity, ts)
 				}
@@ -353,22 +380,19 @@ func TestGetNamespacesToArchive(t *testing.T) {
 			aConfig.Clusters[0].MaxInactiveDays = tc.maxInactiveDays
 			aConfig.Clusters[0].MinInactiveDays = tc.minInactiveDays
 
-			cm := NewClusterMonitor(aConfig, aConfig.Clusters[0], oc, kc, bc.Core())
+			cm, err := NewClusterMonitor(aConfig, aConfig.Clusters[0], oc, kc, bc.Core(), nil, nil)
+			if !assert.Nil(t, err) {
+				return
+			}
 
 			cm.nsIndexer = kcache.NewIndexer(kcache.MetaNamespaceKeyFunc, kcache.Indexers{})
-			cm.rcIndexer = kcache.NewIndexer(kcache.MetaNamespaceKeyFunc, kcache.Indexers{
-				kcache.NamespaceIndex: kcache.MetaNamespaceIndexFunc,
-			})
-			cm.buildIndexer = kcache.NewIndexer(kcache.MetaNamespaceKeyFunc,
-				kcache.Indexers{
-					kcache.NamespaceIndex: kcache.MetaNamespaceIndexFunc,
-				})
+			buildIndexer := sourceObjects(cm, BuildsActivitySource)
 
 			// Add all test data to the cluster monitor first:
 			for _, p := range tc.namespaces {
 				// Add a single build with the requested activity time:
 				build := fakeBuild(p.name, p.name, p.lastActivity)
-				cm.buildIndexer.Add(build)
+				buildIndexer.Add(build)
 				cm.nsIndexer.Add(fakeNamespace(p.name))
 			}
 
@@ -380,6 +404,209 @@ func TestGetNamespacesToArchive(t *testing.T) {
 	}
 }
 
+func TestGetNamespacesToArchiveEmptyNamespaces(t *testing.T) {
+	tests := []struct {
+		name            string
+		useCreationTime bool
+		maxEmptyDays    int
+		unsynced        bool
+		expected        []string
+	}{
+		{
+			name:     "empty namespaces never archived by default",
+			expected: []string{"vinactive1"},
+		},
+		{
+			name:            "creation time used as last activity",
+			useCreationTime: true,
+			expected:        []string{"vinactive1", "empty1", "empty2"},
+		},
+		{
+			name:         "empty namespaces over max empty time",
+			maxEmptyDays: 90, // Feb 28
+			expected:     []string{"vinactive1", "empty1"},
+		},
+		{
+			name:            "max empty time with creation time",
+			useCreationTime: true,
+			maxEmptyDays:    180, // Nov 30
+			expected:        []string{"vinactive1", "empty1", "empty2"},
+		},
+		{
+			// Activity not seen yet must not be mistaken for an empty namespace:
+			name:         "max empty time not applied before sources sync",
+			maxEmptyDays: 90,
+			unsynced:     true,
+			expected:     []string{"vinactive1"},
+		},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			aConfig := config.NewDefaultArchivistConfig()
+			aConfig.Clusters[0].NamespaceCapacity.HighWatermark = 100
+			aConfig.Clusters[0].NamespaceCapacity.LowWatermark = 50
+			aConfig.Clusters[0].MaxInactiveDays = 60 // Mar 30
+			aConfig.Clusters[0].MinInactiveDays = 30 // April 29
+			aConfig.Clusters[0].EmptyNamespaces.UseCreationTime = tc.useCreationTime
+			aConfig.Clusters[0].EmptyNamespaces.MaxEmptyDays = tc.maxEmptyDays
+
+			cm, err := NewClusterMonitor(aConfig, aConfig.Clusters[0], &otestclient.Fake{}, &ktestclient.Clientset{},
+				(&fakebuildclient.Clientset{}).Core(), nil, nil)
+			if !assert.Nil(t, err) {
+				return
+			}
+			cm.nsIndexer = kcache.NewIndexer(kcache.MetaNamespaceKeyFunc, kcache.Indexers{})
+			cm.hasSynced = func() bool { return !tc.unsynced }
+			buildIndexer := sourceObjects(cm, BuildsActivitySource)
+
+			buildIndexer.Add(fakeBuild("vinactive1", "build1", tm(2017, time.January, 9)))
+			buildIndexer.Add(fakeBuild("active1", "build1", tm(2017, time.May, 25)))
+			created := map[string]time.Time{
+				"vinactive1": tm(2016, time.June, 1),
+				"active1":    tm(2016, time.June, 1),
+				"empty1":     tm(2016, time.June, 1),
+				"empty2":     tm(2017, time.March, 1),
+				"empty3":     tm(2017, time.May, 1),
+				"unknown":    {},
+			}
+			for name, c := range created {
+				ns := fakeNamespace(name)
+				ns.CreationTimestamp = kunversioned.NewTime(c)
+				cm.nsIndexer.Add(ns)
+			}
+
+			archiveNamespaces, err := cm.getNamespacesToArchive(tm(2017, time.May, 29))
+			if assert.Nil(t, err) {
+				assertNamespaces(t, tc.expected, archiveNamespaces)
+			}
+		})
+	}
+}
+
+func TestGetNamespacesToArchiveAnnotations(t *testing.T) {
+	tests := []struct {
+		name             string
+		adminAnnotations []string
+		maxExemptDays    int
+		annotations      map[string]string
+		lastActivity     time.Time
+		expected         []string
+	}{
+		{
+			name:         "exempt until date",
+			annotations:  map[string]string{ExemptUntilAnnotation: "2017-05-29"},
+			lastActivity: tm(2017, time.January, 1),
+			expected:     []string{},
+		},
+		{
+			name:         "exempt until time",
+			annotations:  map[string]string{ExemptUntilAnnotation: "2017-05-30T10:00:00Z"},
+			lastActivity: tm(2017, time.January, 1),
+			expected:     []string{},
+		},
+		{
+			name:         "exemption expired",
+			annotations:  map[string]string{ExemptUntilAnnotation: "2017-05-27"},
+			lastActivity: tm(2017, time.January, 1),
+			expected:     []string{"ns1"},
+		},
+		{
+			name:          "exemption beyond max exempt time",
+			maxExemptDays: 30,
+			annotations:   map[string]string{ExemptUntilAnnotation: "2018-01-01"},
+			lastActivity:  tm(2017, time.January, 1),
+			expected:      []string{"ns1"},
+		},
+		{
+			name:         "invalid exemption",
+			annotations:  map[string]string{ExemptUntilAnnotation: "next year"},
+			lastActivity: tm(2017, time.January, 1),
+			expected:     []string{"ns1"},
+		},
+		{
+			name:             "archive immediately",
+			adminAnnotations: []string{ArchiveImmediatelyAnnotation},
+			annotations:      map[string]string{ArchiveImmediatelyAnnotation: "true"},
+			lastActivity:     tm(2017, time.May, 28),
+			expected:         []string{"ns1"},
+		},
+		{
+			name:         "archive immediately not allowed",
+			annotations:  map[string]string{ArchiveImmediatelyAnnotation: "true"},
+			lastActivity: tm(2017, time.May, 28),
+			expected:     []string{},
+		},
+		{
+			name:             "max inactive days",
+			adminAnnotations: []string{MaxInactiveDaysAnnotation},
+			annotations:      map[string]string{MaxInactiveDaysAnnotation: "200"},
+			lastActivity:     tm(2017, time.January, 1),
+			expected:         []string{},
+		},
+		{
+			name:             "min and max inactive days",
+			adminAnnotations: []string{MinInactiveDaysAnnotation, MaxInactiveDaysAnnotation},
+			annotations: map[string]string{
+				MinInactiveDaysAnnotation: "5",
+				MaxInactiveDaysAnnotation: "10",
+			},
+			lastActivity: tm(2017, time.May, 15),
+			expected:     []string{"ns1"},
+		},
+		{
+			name:             "min inactive days over max ignored",
+			adminAnnotations: []string{MinInactiveDaysAnnotation},
+			annotations:      map[string]string{MinInactiveDaysAnnotation: "90"},
+			lastActivity:     tm(2017, time.January, 1),
+			expected:         []string{"ns1"},
+		},
+		{
+			name:             "invalid inactive days ignored",
+			adminAnnotations: []string{MaxInactiveDaysAnnotation},
+			annotations:      map[string]string{MaxInactiveDaysAnnotation: "-1"},
+			lastActivity:     tm(2017, time.January, 1),
+			expected:         []string{"ns1"},
+		},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			aConfig := config.NewDefaultArchivistConfig()
+			aConfig.Clusters[0].NamespaceCapacity.HighWatermark = 100
+			aConfig.Clusters[0].NamespaceCapacity.LowWatermark = 50
+			aConfig.Clusters[0].MaxInactiveDays = 60 // Mar 30
+			aConfig.Clusters[0].MinInactiveDays = 30 // April 29
+			aConfig.Clusters[0].NamespaceAnnotations.AdminAnnotations = tc.adminAnnotations
+			aConfig.Clusters[0].NamespaceAnnotations.MaxExemptDays = tc.maxExemptDays
+
+			cm, err := NewClusterMonitor(aConfig, aConfig.Clusters[0], &otestclient.Fake{}, &ktestclient.Clientset{},
+				(&fakebuildclient.Clientset{}).Core(), nil, nil)
+			if !assert.Nil(t, err) {
+				return
+			}
+			cm.nsIndexer = kcache.NewIndexer(kcache.MetaNamespaceKeyFunc, kcache.Indexers{})
+			sourceObjects(cm, BuildsActivitySource).Add(fakeBuild("ns1", "build1", tc.lastActivity))
+			ns := fakeNamespace("ns1")
+			ns.Annotations = tc.annotations
+			cm.nsIndexer.Add(ns)
+
+			archiveNamespaces, err := cm.getNamespacesToArchive(tm(2017, time.May, 29))
+			if assert.Nil(t, err) {
+				assertNamespaces(t, tc.expected, archiveNamespaces)
+			}
+		})
+	}
+}
+
+func TestUnknownAdminAnnotation(t *testing.T) {
+	aConfig := config.NewDefaultArchivistConfig()
+	aConfig.Clusters[0].NamespaceAnnotations.AdminAnnotations = []string{"archivist.openshift.io/unknown"}
+	_, err := NewClusterMonitor(aConfig, aConfig.Clusters[0], &otestclient.Fake{}, &ktestclient.Clientset{},
+		(&fakebuildclient.Clientset{}).Core(), nil, nil)
+	if assert.NotNil(t, err) {
+		assert.Contains(t, err.Error(), "unknown admin annotation")
+	}
+}
+
 func assertNamespaces(t *testing.T, expected []string, archiveNamespaces []LastActivity) {
 	if assert.Equal(t, len(expected), len(archiveNamespaces)) {
 		for _, expectedName := range expected {
@@ -395,3 +622,649 @@ func assertNamespaces(t *testing.T, expected []string, archiveNamespaces []LastA
 	}
 
 }
+
+type fakeArchiver struct {
+	archived []string
+	failures map[string]bool
+	// archivedFunc, if set, is called after each namespace is archived:
+	archivedFunc func(namespace string)
+}
+
+func (f *fakeArchiver) Archive(namespace *kapi.Namespace, lastActivity time.Time) error {
+	if f.failures[namespace.Name] {
+		return errors.New("archival failed")
+	}
+	f.archived = append(f.archived, namespace.Name)
+	if f.archivedFunc != nil {
+		f.archivedFunc(namespace.Name)
+	}
+	return nil
+}
+
+func TestArchiveNamespaces(t *testing.T) {
+	oc := &otestclient.Fake{}
+	bc := &fakebuildclient.Clientset{}
+	kc := &ktestclient.Clientset{}
+	archiver := &fakeArchiver{failures: map[string]bool{"namespace2": true}}
+
+	aConfig := config.NewDefaultArchivistConfig()
+	cm, err := NewClusterMonitor(aConfig, aConfig.Clusters[0], oc, kc, bc.Core(), archiver, nil)
+	if !assert.Nil(t, err) {
+		return
+	}
+
+	cm.now = func() time.Time { return tm(2017, time.May, 29) }
+
+	cm.archiveNamespaces([]LastActivity{
+		{fakeNamespace("namespace1"), tm(2017, time.January, 1)},
+		{fakeNamespace("namespace2"), tm(2017, time.January, 2)},
+		{fakeNamespace("namespace3"), tm(2017, time.January, 3)},
+	})
+	// A failure on one namespace should not prevent archival of the others:
+	assert.Equal(t, []string{"namespace1", "namespace3"}, archiver.archived)
+	// Progress is recorded for liveness before the check completes:
+	assert.Equal(t, tm(2017, time.May, 29), cm.lastProgress)
+	assert.True(t, cm.lastCheck.IsZero())
+}
+
+func TestArchiveNamespacesFailed(t *testing.T) {
+	archiver := &fakeArchiver{failures: map[string]bool{"namespace1": true, "namespace2": true}}
+	aConfig := config.NewDefaultArchivistConfig()
+	cm, err := NewClusterMonitor(aConfig, aConfig.Clusters[0], &otestclient.Fake{}, &ktestclient.Clientset{},
+		(&fakebuildclient.Clientset{}).Core(), archiver, nil)
+	if !assert.Nil(t, err) {
+		return
+	}
+
+	cm.archiveNamespaces([]LastActivity{
+		{fakeNamespace("namespace1"), tm(2017, time.January, 1)},
+		{fakeNamespace("namespace2"), tm(2017, time.January, 2)},
+	})
+	// Failed archivals are not progress, so a check which only fails is not kept alive by them:
+	assert.Equal(t, 0, len(archiver.archived))
+	assert.True(t, cm.lastProgress.IsZero(), "failed archivals should not be recorded as progress")
+}
+
+func TestArchiveNamespacesStopped(t *testing.T) {
+	stopChan := make(chan struct{})
+	archiver := &fakeArchiver{}
+	// The monitor is stopped while the first namespace is being archived:
+	archiver.archivedFunc = func(namespace string) {
+		close(stopChan)
+	}
+
+	aConfig := config.NewDefaultArchivistConfig()
+	cm, err := NewClusterMonitor(aConfig, aConfig.Clusters[0], &otestclient.Fake{}, &ktestclient.Clientset{},
+		(&fakebuildclient.Clientset{}).Core(), archiver, nil)
+	if !assert.Nil(t, err) {
+		return
+	}
+	cm.stopChannel = stopChan
+
+	cm.archiveNamespaces([]LastActivity{
+		{fakeNamespace("namespace1"), tm(2017, time.January, 1)},
+		{fakeNamespace("namespace2"), tm(2017, time.January, 2)},
+	})
+	assert.Equal(t, []string{"namespace1"}, archiver.archived)
+}
+
+func TestArchiveNamespacesLeadershipLost(t *testing.T) {
+	leading := true
+	archiver := &fakeArchiver{}
+	// Leadership is lost while the first namespace is being archived:
+	archiver.archivedFunc = func(namespace string) {
+		leading = false
+	}
+
+	aConfig := config.NewDefaultArchivistConfig()
+	cm, err := NewClusterMonitor(aConfig, aConfig.Clusters[0], &otestclient.Fake{}, &ktestclient.Clientset{},
+		(&fakebuildclient.Clientset{}).Core(), archiver, nil)
+	if !assert.Nil(t, err) {
+		return
+	}
+	cm.SetLeading(func() bool { return leading })
+
+	cm.archiveNamespaces([]LastActivity{
+		{fakeNamespace("namespace1"), tm(2017, time.January, 1)},
+		{fakeNamespace("namespace2"), tm(2017, time.January, 2)},
+		{fakeNamespace("namespace3"), tm(2017, time.January, 3)},
+	})
+	assert.Equal(t, []string{"namespace1"}, archiver.archived)
+}
+
+func TestArchiveNamespacesDryRun(t *testing.T) {
+	oc := &otestclient.Fake{}
+	bc := &fakebuildclient.Clientset{}
+	kc := &ktestclient.Clientset{}
+	archiver := &fakeArchiver{}
+
+	aConfig := config.NewDefaultArchivistConfig()
+	aConfig.DryRun = true
+	cm, err := NewClusterMonitor(aConfig, aConfig.Clusters[0], oc, kc, bc.Core(), archiver, nil)
+	if !assert.Nil(t, err) {
+		return
+	}
+
+	cm.archiveNamespaces([]LastActivity{
+		{fakeNamespace("namespace1"), tm(2017, time.January, 1)},
+		{fakeNamespace("namespace2"), tm(2017, time.January, 2)},
+	})
+	assert.Equal(t, 0, len(archiver.archived))
+}
+
+func TestHealthy(t *testing.T) {
+	start := time.Date(2017, time.May, 29, 12, 0, 0, 0, time.UTC)
+	tests := []struct {
+		name         string
+		started      time.Time
+		lastCheck    time.Time
+		lastProgress time.Time
+		now          time.Time
+		expectedErr  bool
+	}{
+		{
+			name: "not started",
+			now:  start,
+		},
+		{
+			name:    "started within limit",
+			started: start,
+			now:     start.Add(15 * time.Minute),
+		},
+		{
+			name:        "started and no check completed",
+			started:     start,
+			now:         start.Add(16 * time.Minute),
+			expectedErr: true,
+		},
+		{
+			name:      "recent check",
+			started:   start,
+			lastCheck: start.Add(time.Hour),
+			now:       start.Add(time.Hour + 10*time.Minute),
+		},
+		{
+			name:        "stale check",
+			started:     start,
+			lastCheck:   start.Add(time.Hour),
+			now:         start.Add(time.Hour + 20*time.Minute),
+			expectedErr: true,
+		},
+		{
+			name:         "archival in progress",
+			started:      start,
+			lastCheck:    start.Add(time.Hour),
+			lastProgress: start.Add(time.Hour + 15*time.Minute),
+			now:          start.Add(time.Hour + 20*time.Minute),
+		},
+		{
+			name:         "first archival in progress",
+			started:      start,
+			lastProgress: start.Add(15 * time.Minute),
+			now:          start.Add(20 * time.Minute),
+		},
+		{
+			name:         "stalled archival",
+			started:      start,
+			lastCheck:    start.Add(time.Hour),
+			lastProgress: start.Add(time.Hour + 5*time.Minute),
+			now:          start.Add(time.Hour + 25*time.Minute),
+			expectedErr:  true,
+		},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			aConfig := config.NewDefaultArchivistConfig()
+			cm, err := NewClusterMonitor(aConfig, aConfig.Clusters[0], &otestclient.Fake{}, &ktestclient.Clientset{},
+				(&fakebuildclient.Clientset{}).Core(), nil, nil)
+			if !assert.Nil(t, err) {
+				return
+			}
+			cm.started = tc.started
+			cm.lastCheck = tc.lastCheck
+			cm.lastProgress = tc.lastProgress
+
+			err = cm.Healthy(tc.now)
+			assert.Equal(t, tc.expectedErr, err != nil, fmt.Sprintf("unexpected error: %v", err))
+		})
+	}
+}
+
+func TestCheckCapacityUnsyncedCaches(t *testing.T) {
+	archiver := &fakeArchiver{}
+	aConfig := config.NewDefaultArchivistConfig()
+	aConfig.Clusters[0].NamespaceCapacity.HighWatermark = 1
+	aConfig.Clusters[0].NamespaceCapacity.LowWatermark = 1
+	aConfig.Clusters[0].MaxInactiveDays = 1
+	cm, err := NewClusterMonitor(aConfig, aConfig.Clusters[0], &otestclient.Fake{}, &ktestclient.Clientset{},
+		(&fakebuildclient.Clientset{}).Core(), archiver, nil)
+	if !assert.Nil(t, err) {
+		return
+	}
+
+	// The informers have not been run, so have never synced. The namespace would look inactive without its builds:
+	cm.nsIndexer.Add(fakeNamespace("namespace1"))
+	cm.checkCapacity()
+
+	assert.Equal(t, 0, len(archiver.archived))
+	assert.True(t, cm.lastCheck.IsZero(), "unsynced capacity check should not be counted as completed")
+}
+
+func TestCheckCapacityNotLeading(t *testing.T) {
+	archiver := &fakeArchiver{}
+	aConfig := config.NewDefaultArchivistConfig()
+	aConfig.Clusters[0].NamespaceCapacity.HighWatermark = 1
+	aConfig.Clusters[0].NamespaceCapacity.LowWatermark = 1
+	aConfig.Clusters[0].MaxInactiveDays = 1
+	cm, err := NewClusterMonitor(aConfig, aConfig.Clusters[0], &otestclient.Fake{}, &ktestclient.Clientset{},
+		(&fakebuildclient.Clientset{}).Core(), archiver, nil)
+	if !assert.Nil(t, err) {
+		return
+	}
+	cm.hasSynced = func() bool { return true }
+	cm.SetLeading(func() bool { return false })
+	cm.now = func() time.Time { return tm(2017, time.May, 29) }
+
+	// The namespace would be archived by the leader:
+	cm.nsIndexer.Add(fakeNamespace("namespace1"))
+	sourceObjects(cm, BuildsActivitySource).Add(fakeBuild("namespace1", "build1", tm(2017, time.January, 1)))
+	cm.checkCapacity()
+
+	assert.Equal(t, 0, len(archiver.archived))
+	// Standby replicas stay live while the leader is:
+	assert.Equal(t, tm(2017, time.May, 29), cm.lastCheck)
+}
+
+func TestArchiveNamespacesOutsideMaintenanceWindow(t *testing.T) {
+	archiver := &fakeArchiver{}
+	aConfig := config.NewDefaultArchivistConfig()
+	aConfig.Clusters[0].Schedule.MaintenanceWindows = []config.MaintenanceWindow{
+		{Days: []string{"Mon"}, Start: "09:00", End: "10:00"},
+	}
+	cm, err := NewClusterMonitor(aConfig, aConfig.Clusters[0], &otestclient.Fake{}, &ktestclient.Clientset{},
+		(&fakebuildclient.Clientset{}).Core(), archiver, nil)
+	if !assert.Nil(t, err) {
+		return
+	}
+	namespaces := []LastActivity{
+		{fakeNamespace("namespace1"), tm(2017, time.January, 1)},
+	}
+
+	// Wednesday:
+	cm.now = func() time.Time { return time.Date(2017, time.May, 31, 9, 30, 0, 0, time.UTC) }
+	cm.archiveNamespaces(namespaces)
+	assert.Equal(t, 0, len(archiver.archived))
+
+	// Monday:
+	cm.now = func() time.Time { return time.Date(2017, time.May, 29, 9, 30, 0, 0, time.UTC) }
+	cm.archiveNamespaces(namespaces)
+	assert.Equal(t, []string{"namespace1"}, archiver.archived)
+}
+
+func TestWorkloadLastActivity(t *testing.T) {
+	meta := func(namespace, name string, created time.Time) kapi.ObjectMeta {
+		return kapi.ObjectMeta{Namespace: namespace, Name: name, CreationTimestamp: kunversioned.NewTime(created)}
+	}
+	timePtr := func(t time.Time) *kunversioned.Time {
+		ut := kunversioned.NewTime(t)
+		return &ut
+	}
+
+	tests := []struct {
+		name     string
+		objects  func(cm *ClusterMonitor)
+		expected time.Time
+	}{
+		{
+			name: "deployment config rollout",
+			objects: func(cm *ClusterMonitor) {
+				dc := &deployapi.DeploymentConfig{ObjectMeta: meta("ns", "dc1", tm(2017, time.January, 1))}
+				dc.Status.Conditions = []deployapi.DeploymentCondition{
+					{
+						Type:               deployapi.DeploymentProgressing,
+						Reason:             newReplicationControllerReason,
+						LastTransitionTime: kunversioned.NewTime(tm(2017, time.March, 1)),
+					},
+				}
+				sourceObjects(cm, DeploymentConfigsActivitySource).Add(dc)
+			},
+			expected: tm(2017, time.March, 1),
+		},
+		{
+			name: "deployment config availability",
+			objects: func(cm *ClusterMonitor) {
+				// Availability changes as pods crash, without anyone touching the deployment config:
+				dc := &deployapi.DeploymentConfig{ObjectMeta: meta("ns", "dc1", tm(2017, time.January, 1))}
+				dc.Status.Conditions = []deployapi.DeploymentCondition{
+					{
+						Type:               deployapi.DeploymentAvailable,
+						LastTransitionTime: kunversioned.NewTime(tm(2017, time.May, 1)),
+					},
+				}
+				sourceObjects(cm, DeploymentConfigsActivitySource).Add(dc)
+				dc.Status.Conditions[0].LastTransitionTime = kunversioned.NewTime(tm(2017, time.May, 2))
+				sourceObjects(cm, DeploymentConfigsActivitySource).Add(dc)
+			},
+			expected: tm(2017, time.January, 1),
+		},
+		{
+			name: "deployment rollout update",
+			objects: func(cm *ClusterMonitor) {
+				d := &extensions.Deployment{ObjectMeta: meta("ns", "d1", tm(2017, time.January, 1))}
+				d.Status.Conditions = []extensions.DeploymentCondition{
+					{
+						Type:               extensions.DeploymentProgressing,
+						Reason:             newReplicaSetReason,
+						LastUpdateTime:     kunversioned.NewTime(tm(2017, time.April, 1)),
+						LastTransitionTime: kunversioned.NewTime(tm(2017, time.February, 1)),
+					},
+				}
+				sourceObjects(cm, DeploymentsActivitySource).Add(d)
+			},
+			expected: tm(2017, time.April, 1),
+		},
+		{
+			name: "deployment availability",
+			objects: func(cm *ClusterMonitor) {
+				d := &extensions.Deployment{ObjectMeta: meta("ns", "d1", tm(2017, time.January, 1))}
+				d.Status.Conditions = []extensions.DeploymentCondition{
+					{
+						Type:               extensions.DeploymentProgressing,
+						Reason:             "NewReplicaSetAvailable",
+						LastUpdateTime:     kunversioned.NewTime(tm(2017, time.February, 1)),
+						LastTransitionTime: kunversioned.NewTime(tm(2017, time.February, 1)),
+					},
+					{
+						Type:               extensions.DeploymentAvailable,
+						LastUpdateTime:     kunversioned.NewTime(tm(2017, time.May, 1)),
+						LastTransitionTime: kunversioned.NewTime(tm(2017, time.May, 1)),
+					},
+				}
+				sourceObjects(cm, DeploymentsActivitySource).Add(d)
+				d.Status.Conditions[1].LastUpdateTime = kunversioned.NewTime(tm(2017, time.May, 2))
+				d.Status.Conditions[1].LastTransitionTime = kunversioned.NewTime(tm(2017, time.May, 2))
+				sourceObjects(cm, DeploymentsActivitySource).Add(d)
+			},
+			expected: tm(2017, time.January, 1),
+		},
+		{
+			name: "newest replica set",
+			objects: func(cm *ClusterMonitor) {
+				sourceObjects(cm, ReplicaSetsActivitySource).Add(&extensions.ReplicaSet{ObjectMeta: meta("ns", "rs1", tm(2017, time.January, 1))})
+				sourceObjects(cm, ReplicaSetsActivitySource).Add(&extensions.ReplicaSet{ObjectMeta: meta("ns", "rs2", tm(2017, time.May, 1))})
+				// Other namespaces are not considered:
+				sourceObjects(cm, ReplicaSetsActivitySource).Add(&extensions.ReplicaSet{ObjectMeta: meta("other", "rs3", tm(2017, time.May, 2))})
+			},
+			expected: tm(2017, time.May, 1),
+		},
+		{
+			name: "stateful set and daemon set",
+			objects: func(cm *ClusterMonitor) {
+				sourceObjects(cm, StatefulSetsActivitySource).Add(&apps.StatefulSet{ObjectMeta: meta("ns", "ss1", tm(2017, time.February, 1))})
+				sourceObjects(cm, DaemonSetsActivitySource).Add(&extensions.DaemonSet{ObjectMeta: meta("ns", "ds1", tm(2017, time.March, 1))})
+			},
+			expected: tm(2017, time.March, 1),
+		},
+		{
+			name: "job completion",
+			objects: func(cm *ClusterMonitor) {
+				job := &batch.Job{ObjectMeta: meta("ns", "job1", tm(2017, time.January, 1))}
+				job.Status.StartTime = timePtr(tm(2017, time.January, 2))
+				job.Status.CompletionTime = timePtr(tm(2017, time.January, 3))
+				sourceObjects(cm, JobsActivitySource).Add(job)
+			},
+			expected: tm(2017, time.January, 3),
+		},
+		{
+			name: "image stream tag history",
+			objects: func(cm *ClusterMonitor) {
+				is := &imageapi.ImageStream{ObjectMeta: meta("ns", "is1", tm(2017, time.January, 1))}
+				is.Spec.Tags = map[string]imageapi.TagReference{
+					"upstream": {ImportPolicy: imageapi.TagImportPolicy{Scheduled: true}},
+				}
+				is.Status.Tags = map[string]imageapi.TagEventList{
+					"latest": {Items: []imageapi.TagEvent{
+						{Created: kunversioned.NewTime(tm(2017, time.April, 2))},
+						{Created: kunversioned.NewTime(tm(2017, time.February, 2))},
+					}},
+					// Scheduled imports are not activity:
+					"upstream": {Items: []imageapi.TagEvent{
+						{Created: kunversioned.NewTime(tm(2017, time.May, 2))},
+					}},
+				}
+				sourceObjects(cm, ImageStreamsActivitySource).Add(is)
+			},
+			expected: tm(2017, time.April, 2),
+		},
+		{
+			name: "workload newer than build",
+			objects: func(cm *ClusterMonitor) {
+				sourceObjects(cm, BuildsActivitySource).Add(fakeBuild("ns", "build1", tm(2017, time.January, 1)))
+				sourceObjects(cm, JobsActivitySource).Add(&batch.Job{ObjectMeta: meta("ns", "job1", tm(2017, time.February, 1))})
+			},
+			expected: tm(2017, time.February, 1),
+		},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			aConfig := config.NewDefaultArchivistConfig()
+			cm, err := NewClusterMonitor(aConfig, aConfig.Clusters[0], &otestclient.Fake{}, &ktestclient.Clientset{},
+				(&fakebuildclient.Clientset{}).Core(), nil, nil)
+			if !assert.Nil(t, err) {
+				return
+			}
+			tc.objects(cm)
+
+			lastActivity, err := cm.getLastActivity("ns", tm(2017, time.May, 29))
+			if assert.Nil(t, err) {
+				assert.Equal(t, tc.expected, lastActivity)
+			}
+		})
+	}
+}
+
+func TestActivitySourceConfig(t *testing.T) {
+	disabled := false
+	tests := []struct {
+		name                string
+		sources             map[string]config.ActivitySourceConfig
+		expected            time.Time
+		expectedErrContains string
+	}{
+		{
+			name:     "defaults",
+			expected: tm(2017, time.March, 1),
+		},
+		{
+			name: "source disabled",
+			sources: map[string]config.ActivitySourceConfig{
+				JobsActivitySource: {Enabled: &disabled},
+			},
+			expected: tm(2017, time.January, 1),
+		},
+		{
+			// The job is 89 days old, but appears 178 days old:
+			name: "source weighted",
+			sources: map[string]config.ActivitySourceConfig{
+				JobsActivitySource: {Weight: 0.5},
+			},
+			expected: tm(2017, time.January, 1),
+		},
+		{
+			// The build is 148 days old, but appears 37 days old:
+			name: "source weighted up",
+			sources: map[string]config.ActivitySourceConfig{
+				BuildsActivitySource: {Weight: 4},
+			},
+			expected: tm(2017, time.April, 22),
+		},
+		{
+			name: "unknown source",
+			sources: map[string]config.ActivitySourceConfig{
+				"carrier-pigeons": {},
+			},
+			expectedErrContains: "unknown activity source",
+		},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			aConfig := config.NewDefaultArchivistConfig()
+			aConfig.Clusters[0].ActivitySources = tc.sources
+			cm, err := NewClusterMonitor(aConfig, aConfig.Clusters[0], &otestclient.Fake{}, &ktestclient.Clientset{},
+				(&fakebuildclient.Clientset{}).Core(), nil, nil)
+			if tc.expectedErrContains != "" {
+				if assert.NotNil(t, err) {
+					assert.Contains(t, err.Error(), tc.expectedErrContains)
+				}
+				return
+			}
+			if !assert.Nil(t, err) {
+				return
+			}
+			sourceObjects(cm, BuildsActivitySource).Add(fakeBuild("ns", "build1", tm(2017, time.January, 1)))
+			for _, ws := range cm.sources {
+				if ws.name == JobsActivitySource {
+					sourceObjects(cm, JobsActivitySource).Add(&batch.Job{ObjectMeta: kapi.ObjectMeta{
+						Namespace:         "ns",
+						Name:              "job1",
+						CreationTimestamp: kunversioned.NewTime(tm(2017, time.March, 1)),
+					}})
+				}
+			}
+
+			lastActivity, err := cm.getLastActivity("ns", tm(2017, time.May, 29))
+			if assert.Nil(t, err) {
+				assert.Equal(t, tc.expected, lastActivity)
+			}
+		})
+	}
+}
+
+func TestStoredActivity(t *testing.T) {
+	dir, err := ioutil.TempDir("", "clustermonitor")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	store, err := activitystore.Open(filepath.Join(dir, "activity.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer store.Close()
+	cs, err := store.Cluster("local cluster")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	aConfig := config.NewDefaultArchivistConfig()
+	cm, err := NewClusterMonitor(aConfig, aConfig.Clusters[0], &otestclient.Fake{}, &ktestclient.Clientset{},
+		(&fakebuildclient.Clientset{}).Core(), nil, cs)
+	if !assert.Nil(t, err) {
+		return
+	}
+
+	// Activity is stored as the informer reports objects:
+	sourceObjects(cm, BuildsActivitySource).Add(fakeBuild("ns", "build2", tm(2017, time.March, 1)))
+	assert.Equal(t, activitystore.Record{Time: tm(2017, time.March, 1), Kind: "Build", Name: "build2"},
+		cs.Get("ns", BuildsActivitySource))
+
+	// And is used by a new monitor, e.g. after a restart, once the build has been pruned leaving only an older
+	// build:
+	cm, err = NewClusterMonitor(aConfig, aConfig.Clusters[0], &otestclient.Fake{}, &ktestclient.Clientset{},
+		(&fakebuildclient.Clientset{}).Core(), nil, cs)
+	if !assert.Nil(t, err) {
+		return
+	}
+	sourceObjects(cm, BuildsActivitySource).Add(fakeBuild("ns", "build1", tm(2017, time.January, 1)))
+	lastActivity, err := cm.getLastActivity("ns", tm(2017, time.May, 29))
+	if assert.Nil(t, err) {
+		assert.Equal(t, tm(2017, time.March, 1), lastActivity)
+	}
+
+	// Newer activity from the informer replaces stored activity:
+	sourceObjects(cm, BuildsActivitySource).Add(fakeBuild("ns", "build3", tm(2017, time.April, 1)))
+	lastActivity, err = cm.getLastActivity("ns", tm(2017, time.May, 29))
+	if assert.Nil(t, err) {
+		assert.Equal(t, tm(2017, time.April, 1), lastActivity)
+	}
+
+	// Activity is forgotten when the namespace is deleted:
+	cm.namespaceDeleted(fakeNamespace("ns"))
+	assert.Equal(t, activitystore.Record{}, cs.Get("ns", BuildsActivitySource))
+	lastActivity, err = cm.getLastActivity("ns", tm(2017, time.May, 29))
+	if assert.Nil(t, err) {
+		assert.Equal(t, time.Time{}, lastActivity)
+	}
+}
+
+func TestActivityIndex(t *testing.T) {
+	aConfig := config.NewDefaultArchivistConfig()
+	cm, err := NewClusterMonitor(aConfig, aConfig.Clusters[0], &otestclient.Fake{}, &ktestclient.Clientset{},
+		(&fakebuildclient.Clientset{}).Core(), nil, nil)
+	if !assert.Nil(t, err) {
+		return
+	}
+	builds := sourceObjects(cm, BuildsActivitySource).source
+
+	// A build which has not started yet has no activity until it is updated:
+	build := fakeBuild("ns", "build1", tm(2017, time.January, 1))
+	build.Status.StartTimestamp = nil
+	builds.observe(build)
+	lastActivity, err := cm.getLastActivity("ns", tm(2017, time.May, 29))
+	if assert.Nil(t, err) {
+		assert.Equal(t, time.Time{}, lastActivity)
+	}
+	builds.observe(fakeBuild("ns", "build1", tm(2017, time.February, 1)))
+	lastActivity, err = cm.getLastActivity("ns", tm(2017, time.May, 29))
+	if assert.Nil(t, err) {
+		assert.Equal(t, tm(2017, time.February, 1), lastActivity)
+	}
+
+	// Older objects do not replace newer activity:
+	builds.observe(fakeBuild("ns", "build0", tm(2017, time.January, 1)))
+	lastActivity, err = cm.getLastActivity("ns", tm(2017, time.May, 29))
+	if assert.Nil(t, err) {
+		assert.Equal(t, tm(2017, time.February, 1), lastActivity)
+	}
+
+	// Deleted namespaces may be reported as tombstones:
+	cm.namespaceDeleted(kcache.DeletedFinalStateUnknown{Key: "ns", Obj: fakeNamespace("ns")})
+	lastActivity, err = cm.getLastActivity("ns", tm(2017, time.May, 29))
+	if assert.Nil(t, err) {
+		assert.Equal(t, time.Time{}, lastActivity)
+	}
+}
+
+// syncedInformer is an informer which is never run, and reports whether it has synced as told.
+type syncedInformer struct {
+	kcache.SharedIndexInformer
+	synced bool
+}
+
+func (i *syncedInformer) HasSynced() bool {
+	return i.synced
+}
+
+func TestInformerSourceHasSynced(t *testing.T) {
+	informer := &syncedInformer{SharedIndexInformer: newNamespacedInformer(nil, nil, &buildapi.Build{})}
+	s, err := newInformerSource(ActivitySourceContext{}, BuildsActivitySource, "Build", informer, buildActivity)
+	if !assert.Nil(t, err) {
+		return
+	}
+	assert.False(t, s.HasSynced())
+
+	// The informer has listed the build, but has not yet called any event handlers:
+	informer.GetIndexer().Add(fakeBuild("ns", "build1", tm(2017, time.February, 1)))
+	informer.synced = true
+	activity, err := s.LastActivity("ns")
+	if assert.Nil(t, err) {
+		assert.True(t, activity.Time.IsZero())
+	}
+
+	if assert.True(t, s.HasSynced()) {
+		activity, err = s.LastActivity("ns")
+		if assert.Nil(t, err) {
+			assert.Equal(t, Activity{Time: tm(2017, time.February, 1), Kind: "Build", Name: "build1"}, activity)
+		}
+	}
+}
@@ -0,0 +1,50 @@
+package clustermonitor
+
+import (
+	"time"
+
+	kapi "k8s.io/kubernetes/pkg/api"
+	"k8s.io/kubernetes/pkg/runtime"
+	"k8s.io/kubernetes/pkg/watch"
+)
+
+// EventsActivitySource is the activity source for events with reasons configured as user activity, enabled by
+// default. The API server only keeps events for a short time, so this source only sees recent activity.
+const EventsActivitySource = "events"
+
+func init() {
+	RegisterActivitySource(EventsActivitySource, true, func(ctx ActivitySourceContext) (ActivitySource, error) {
+		informer := newNamespacedInformer(
+			func(options kapi.ListOptions) (runtime.Object, error) {
+				return ctx.KC.Core().Events(kapi.NamespaceAll).List(options)
+			},
+			func(options kapi.ListOptions) (watch.Interface, error) {
+				return ctx.KC.Core().Events(kapi.NamespaceAll).Watch(options)
+			},
+			&kapi.Event{},
+		)
+		cfg := ctx.ClusterConfig.EventActivity
+		reasons := map[string]bool{}
+		for _, reason := range cfg.Reasons {
+			reasons[reason] = true
+		}
+		ignored := map[string]bool{}
+		for _, reason := range cfg.IgnoredReasons {
+			ignored[reason] = true
+		}
+		return newInformerSource(ctx, EventsActivitySource, "Event", informer, func(obj interface{}) time.Time {
+			event := obj.(*kapi.Event)
+			if ignored[event.Reason] || (len(reasons) > 0 && !reasons[event.Reason]) {
+				return time.Time{}
+			}
+			return eventActivity(event)
+		})
+	})
+}
+
+// eventActivity is the last time the event occurred. Repeated events are combined into one, with a count and the
+// time of the first and last occurrence.
+func eventActivity(event *kapi.Event) time.Time {
+	latest := laterOf(event.CreationTimestamp.Time, event.FirstTimestamp.Time)
+	return laterOf(latest, event.LastTimestamp.Time)
+}
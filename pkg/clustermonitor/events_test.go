@@ -0,0 +1,101 @@
+package clustermonitor
+
+import (
+	"testing"
+	"time"
+
+	"github.com/openshift/online/archivist/pkg/config"
+
+	fakebuildclient "github.com/openshift/origin/pkg/build/client/clientset_generated/internalclientset/fake"
+	otestclient "github.com/openshift/origin/pkg/client/testclient"
+
+	kapi "k8s.io/kubernetes/pkg/api"
+	kunversioned "k8s.io/kubernetes/pkg/api/unversioned"
+	ktestclient "k8s.io/kubernetes/pkg/client/clientset_generated/internalclientset/fake"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func fakeEvent(name, reason string, first, last time.Time) *kapi.Event {
+	return &kapi.Event{
+		ObjectMeta: kapi.ObjectMeta{
+			Name:              name,
+			Namespace:         "ns",
+			CreationTimestamp: kunversioned.NewTime(first),
+		},
+		Reason:         reason,
+		FirstTimestamp: kunversioned.NewTime(first),
+		LastTimestamp:  kunversioned.NewTime(last),
+	}
+}
+
+func TestEventLastActivity(t *testing.T) {
+	tests := []struct {
+		name           string
+		reasons        []string
+		ignoredReasons []string
+		events         []*kapi.Event
+		expected       time.Time
+	}{
+		{
+			name: "default reasons",
+			events: []*kapi.Event{
+				fakeEvent("event1", "ScalingReplicaSet", tm(2017, time.January, 1), tm(2017, time.January, 1)),
+				// Pulls are repeated on every restart of a crash looping container:
+				fakeEvent("event2", "Pulling", tm(2017, time.February, 1), tm(2017, time.March, 1)),
+				fakeEvent("event3", "Pulled", tm(2017, time.February, 1), tm(2017, time.March, 1)),
+				fakeEvent("event4", "BackOff", tm(2017, time.April, 1), tm(2017, time.May, 1)),
+			},
+			expected: tm(2017, time.January, 1),
+		},
+		{
+			name:    "configured reasons",
+			reasons: []string{"BackOff"},
+			events: []*kapi.Event{
+				fakeEvent("event1", "Pulling", tm(2017, time.February, 1), tm(2017, time.March, 1)),
+				fakeEvent("event2", "BackOff", tm(2017, time.April, 1), tm(2017, time.May, 1)),
+			},
+			expected: tm(2017, time.May, 1),
+		},
+		{
+			name:           "any reason except ignored",
+			reasons:        []string{},
+			ignoredReasons: []string{"BackOff"},
+			events: []*kapi.Event{
+				fakeEvent("event1", "Unhealthy", tm(2017, time.February, 1), tm(2017, time.March, 1)),
+				fakeEvent("event2", "BackOff", tm(2017, time.April, 1), tm(2017, time.May, 1)),
+			},
+			expected: tm(2017, time.March, 1),
+		},
+		{
+			name:           "all ignored",
+			ignoredReasons: []string{"Pulling"},
+			reasons:        []string{"Pulled"},
+			events: []*kapi.Event{
+				fakeEvent("event1", "Pulling", tm(2017, time.February, 1), tm(2017, time.March, 1)),
+			},
+		},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			aConfig := config.NewDefaultArchivistConfig()
+			if tc.reasons != nil {
+				aConfig.Clusters[0].EventActivity.Reasons = tc.reasons
+			}
+			aConfig.Clusters[0].EventActivity.IgnoredReasons = tc.ignoredReasons
+			cm, err := NewClusterMonitor(aConfig, aConfig.Clusters[0], &otestclient.Fake{}, &ktestclient.Clientset{},
+				(&fakebuildclient.Clientset{}).Core(), nil, nil)
+			if !assert.Nil(t, err) {
+				return
+			}
+			for _, event := range tc.events {
+				sourceObjects(cm, EventsActivitySource).Add(event)
+			}
+
+			lastActivity, err := cm.getLastActivity("ns", tm(2017, time.May, 29))
+			if assert.Nil(t, err) {
+				assert.Equal(t, tc.expected, lastActivity)
+			}
+		})
+	}
+}
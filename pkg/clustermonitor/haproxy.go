@@ -0,0 +1,83 @@
+package clustermonitor
+
+import (
+	"regexp"
+	"strings"
+	"time"
+)
+
+// haproxyLogRegexp matches the fields of an HAProxy HTTP log line, as written by the router with "option httplog",
+// used to find activity: the accept date, the backend and the status code. Any syslog header before the client
+// address is skipped.
+var haproxyLogRegexp = regexp.MustCompile(`\S+:\d+ \[([^\]]+)\] \S+ ([^/\s]+)/\S+ \S+ (-?\d+) `)
+
+// haproxyCaptureRegexp matches the first captured request header, which routers configured to capture the Host
+// header log as "{www.example.com}" after the termination state of the request.
+var haproxyCaptureRegexp = regexp.MustCompile(` \{([^|}]*)[^}]*\}`)
+
+const haproxyDateLayout = "02/Jan/2006:15:04:05.000"
+
+// Prefixes of the backends the router creates for each route, followed by the namespace and name of the route
+// separated by ":" (or "_" before OpenShift 3.6):
+var routerBackendPrefixes = []string{"be_http", "be_edge_http", "be_secure", "be_tcp"}
+
+// accessLogEntry is a request found in a router access log.
+type accessLogEntry struct {
+	Time    time.Time
+	Backend string
+	// Host is the captured Host header, lower case and without any port, or empty if not captured.
+	Host   string
+	Status string
+}
+
+// parseAccessLog parses an HAProxy HTTP log line. Accept dates are logged without a time zone, so are parsed in
+// the given location. It returns false if the line is not an HTTP log line.
+func parseAccessLog(line string, location *time.Location) (accessLogEntry, bool) {
+	match := haproxyLogRegexp.FindStringSubmatchIndex(line)
+	if match == nil {
+		return accessLogEntry{}, false
+	}
+	ts, err := time.ParseInLocation(haproxyDateLayout, line[match[2]:match[3]], location)
+	if err != nil {
+		return accessLogEntry{}, false
+	}
+	entry := accessLogEntry{
+		Time:    ts,
+		Backend: line[match[4]:match[5]],
+		Status:  line[match[6]:match[7]],
+	}
+	// Only look for captured headers before the quoted request, whose URL may contain braces:
+	rest := line[match[1]:]
+	if i := strings.Index(rest, `"`); i >= 0 {
+		rest = rest[:i]
+	}
+	if capture := haproxyCaptureRegexp.FindStringSubmatch(rest); capture != nil {
+		entry.Host = strings.ToLower(capture[1])
+		if i := strings.LastIndex(entry.Host, ":"); i >= 0 {
+			entry.Host = entry.Host[:i]
+		}
+	}
+	return entry, true
+}
+
+// parseRouterBackend returns the namespace and name of the route a router backend was created for, or false if
+// the backend is not for a route.
+func parseRouterBackend(backend string) (string, string, bool) {
+	for _, prefix := range routerBackendPrefixes {
+		if !strings.HasPrefix(backend, prefix) || len(backend) == len(prefix) {
+			continue
+		}
+		// Namespace and route names can contain neither separator, so the first separator ends the namespace:
+		rest := backend[len(prefix)+1:]
+		sep := backend[len(prefix)]
+		if sep != ':' && sep != '_' {
+			continue
+		}
+		i := strings.IndexByte(rest, sep)
+		if i <= 0 || i == len(rest)-1 {
+			continue
+		}
+		return rest[:i], rest[i+1:], true
+	}
+	return "", "", false
+}
@@ -0,0 +1,83 @@
+package clustermonitor
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseAccessLog(t *testing.T) {
+	tests := []struct {
+		name     string
+		line     string
+		expected accessLogEntry
+		ok       bool
+	}{
+		{
+			name: "syslog message with captured host",
+			line: `<134>May 29 12:14:14 haproxy[141]: 10.0.1.2:33317 [29/May/2017:12:14:14.655] fe_sni be_secure:ns1:www/pod:web-1:10.1.2.3:8080 10/0/30/69/109 200 2750 - - ---- 1/1/1/1/0 0/0 {WWW.Example.com:443} "GET /index.html?q={x} HTTP/1.1"`,
+			expected: accessLogEntry{
+				Time:    time.Date(2017, time.May, 29, 12, 14, 14, 655000000, time.UTC),
+				Backend: "be_secure:ns1:www",
+				Host:    "www.example.com",
+				Status:  "200",
+			},
+			ok: true,
+		},
+		{
+			name: "no captured headers",
+			line: `10.0.1.2:33317 [29/May/2017:12:14:14.655] public be_http_ns1_www/pod:web-1 10/0/30/69/109 503 2750 - - ---- 1/1/1/1/0 0/0 "GET /{x} HTTP/1.1"`,
+			expected: accessLogEntry{
+				Time:    time.Date(2017, time.May, 29, 12, 14, 14, 655000000, time.UTC),
+				Backend: "be_http_ns1_www",
+				Status:  "503",
+			},
+			ok: true,
+		},
+		{
+			name: "not an http log",
+			line: `May 29 12:14:14 haproxy[141]: Proxy be_http:ns1:www started.`,
+		},
+		{
+			name: "invalid date",
+			line: `10.0.1.2:33317 [yesterday] public be_http:ns1:www/pod 10/0/30/69/109 200 2750 - - ---- 1/1/1/1/0 0/0 "GET / HTTP/1.1"`,
+		},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			entry, ok := parseAccessLog(tc.line, time.UTC)
+			assert.Equal(t, tc.ok, ok)
+			if tc.ok {
+				assert.Equal(t, tc.expected, entry)
+			}
+		})
+	}
+}
+
+func TestParseRouterBackend(t *testing.T) {
+	tests := []struct {
+		backend   string
+		namespace string
+		route     string
+		ok        bool
+	}{
+		{backend: "be_http:ns1:www", namespace: "ns1", route: "www", ok: true},
+		{backend: "be_edge_http:my-project:web.example", namespace: "my-project", route: "web.example", ok: true},
+		{backend: "be_secure_ns1_www", namespace: "ns1", route: "www", ok: true},
+		{backend: "be_tcp:ns1:db", namespace: "ns1", route: "db", ok: true},
+		{backend: "openshift_default"},
+		{backend: "be_http"},
+		{backend: "be_http:ns1"},
+		{backend: "be_http:ns1:"},
+		{backend: "be_httpx:ns1:www"},
+	}
+	for _, tc := range tests {
+		t.Run(tc.backend, func(t *testing.T) {
+			namespace, route, ok := parseRouterBackend(tc.backend)
+			assert.Equal(t, tc.ok, ok)
+			assert.Equal(t, tc.namespace, namespace)
+			assert.Equal(t, tc.route, route)
+		})
+	}
+}
@@ -0,0 +1,92 @@
+package clustermonitor
+
+import (
+	"encoding/json"
+	"time"
+
+	buildapi "github.com/openshift/origin/pkg/build/api"
+	deployapi "github.com/openshift/origin/pkg/deploy/api"
+
+	kapi "k8s.io/kubernetes/pkg/api"
+	"k8s.io/kubernetes/pkg/runtime"
+	"k8s.io/kubernetes/pkg/watch"
+)
+
+// PodsActivitySource is the activity source for pod creation, starts and container state changes, enabled by default.
+const PodsActivitySource = "pods"
+
+const (
+	// Owner kinds for pods created by OpenShift without an owner reference:
+	buildPodOwnerKind    = "Build"
+	deployerPodOwnerKind = "Deployer"
+)
+
+func init() {
+	RegisterActivitySource(PodsActivitySource, true, func(ctx ActivitySourceContext) (ActivitySource, error) {
+		informer := newNamespacedInformer(
+			func(options kapi.ListOptions) (runtime.Object, error) {
+				return ctx.KC.Core().Pods(kapi.NamespaceAll).List(options)
+			},
+			func(options kapi.ListOptions) (watch.Interface, error) {
+				return ctx.KC.Core().Pods(kapi.NamespaceAll).Watch(options)
+			},
+			&kapi.Pod{},
+		)
+		ignored := map[string]bool{}
+		for _, kind := range ctx.ClusterConfig.PodActivity.IgnoredOwnerKinds {
+			ignored[kind] = true
+		}
+		return newInformerSource(ctx, PodsActivitySource, "Pod", informer, func(obj interface{}) time.Time {
+			pod := obj.(*kapi.Pod)
+			if ignored[podOwnerKind(pod)] {
+				return time.Time{}
+			}
+			return podActivity(pod)
+		})
+	})
+}
+
+// podActivity is the most recent of the creation and start of the pod, and the start or termination of any of its
+// containers. Containers which are restarted, whether by a user or after crashing, update their start time.
+func podActivity(pod *kapi.Pod) time.Time {
+	latest := pod.CreationTimestamp.Time
+	if pod.Status.StartTime != nil {
+		latest = laterOf(latest, pod.Status.StartTime.Time)
+	}
+	statuses := append([]kapi.ContainerStatus{}, pod.Status.InitContainerStatuses...)
+	statuses = append(statuses, pod.Status.ContainerStatuses...)
+	for _, cs := range statuses {
+		for _, state := range []kapi.ContainerState{cs.State, cs.LastTerminationState} {
+			if state.Running != nil {
+				latest = laterOf(latest, state.Running.StartedAt.Time)
+			}
+			if state.Terminated != nil {
+				latest = laterOf(latest, state.Terminated.StartedAt.Time)
+				latest = laterOf(latest, state.Terminated.FinishedAt.Time)
+			}
+		}
+	}
+	return latest
+}
+
+// podOwnerKind returns the kind of controller which created the pod, or an empty string if it was created directly.
+func podOwnerKind(pod *kapi.Pod) string {
+	if _, ok := pod.Annotations[buildapi.BuildAnnotation]; ok {
+		return buildPodOwnerKind
+	}
+	if _, ok := pod.Labels[deployapi.DeployerPodForDeploymentLabel]; ok {
+		return deployerPodOwnerKind
+	}
+	for _, ref := range pod.OwnerReferences {
+		if ref.Controller != nil && *ref.Controller {
+			return ref.Kind
+		}
+	}
+	if createdBy, ok := pod.Annotations[kapi.CreatedByAnnotation]; ok {
+		var ref kapi.SerializedReference
+		if err := json.Unmarshal([]byte(createdBy), &ref); err == nil {
+			return ref.Reference.Kind
+		}
+	}
+	return ""
+}
@@ -0,0 +1,178 @@
+package clustermonitor
+
+import (
+	"testing"
+	"time"
+
+	"github.com/openshift/online/archivist/pkg/config"
+
+	fakebuildclient "github.com/openshift/origin/pkg/build/client/clientset_generated/internalclientset/fake"
+	otestclient "github.com/openshift/origin/pkg/client/testclient"
+
+	kapi "k8s.io/kubernetes/pkg/api"
+	kunversioned "k8s.io/kubernetes/pkg/api/unversioned"
+	ktestclient "k8s.io/kubernetes/pkg/client/clientset_generated/internalclientset/fake"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func fakePod(name string, created time.Time) *kapi.Pod {
+	return &kapi.Pod{
+		ObjectMeta: kapi.ObjectMeta{
+			Name:              name,
+			Namespace:         "ns",
+			CreationTimestamp: kunversioned.NewTime(created),
+			Annotations:       map[string]string{},
+			Labels:            map[string]string{},
+		},
+	}
+}
+
+func TestPodLastActivity(t *testing.T) {
+	utm := func(year int, month time.Month, day int) kunversioned.Time {
+		return kunversioned.NewTime(tm(year, month, day))
+	}
+	controller := true
+
+	tests := []struct {
+		name              string
+		ignoredOwnerKinds []string
+		pod               func() *kapi.Pod
+		expected          time.Time
+	}{
+		{
+			name: "created",
+			pod: func() *kapi.Pod {
+				return fakePod("pod1", tm(2017, time.January, 1))
+			},
+			expected: tm(2017, time.January, 1),
+		},
+		{
+			name: "started",
+			pod: func() *kapi.Pod {
+				pod := fakePod("pod1", tm(2017, time.January, 1))
+				started := utm(2017, time.January, 2)
+				pod.Status.StartTime = &started
+				return pod
+			},
+			expected: tm(2017, time.January, 2),
+		},
+		{
+			name: "container restarted",
+			pod: func() *kapi.Pod {
+				pod := fakePod("pod1", tm(2017, time.January, 1))
+				pod.Status.ContainerStatuses = []kapi.ContainerStatus{
+					{
+						State: kapi.ContainerState{
+							Running: &kapi.ContainerStateRunning{StartedAt: utm(2017, time.March, 5)},
+						},
+						LastTerminationState: kapi.ContainerState{
+							Terminated: &kapi.ContainerStateTerminated{
+								StartedAt:  utm(2017, time.January, 1),
+								FinishedAt: utm(2017, time.March, 4),
+							},
+						},
+					},
+				}
+				return pod
+			},
+			expected: tm(2017, time.March, 5),
+		},
+		{
+			name: "init container terminated",
+			pod: func() *kapi.Pod {
+				pod := fakePod("pod1", tm(2017, time.January, 1))
+				pod.Status.InitContainerStatuses = []kapi.ContainerStatus{
+					{
+						State: kapi.ContainerState{
+							Terminated: &kapi.ContainerStateTerminated{
+								StartedAt:  utm(2017, time.January, 1),
+								FinishedAt: utm(2017, time.January, 3),
+							},
+						},
+					},
+				}
+				return pod
+			},
+			expected: tm(2017, time.January, 3),
+		},
+		{
+			name: "build pod ignored by default",
+			pod: func() *kapi.Pod {
+				pod := fakePod("pod1", tm(2017, time.January, 1))
+				pod.Annotations["openshift.io/build.name"] = "build1"
+				return pod
+			},
+		},
+		{
+			name: "deployer pod ignored by default",
+			pod: func() *kapi.Pod {
+				pod := fakePod("pod1", tm(2017, time.January, 1))
+				pod.Labels["openshift.io/deployer-pod-for.name"] = "frontend-1"
+				return pod
+			},
+		},
+		{
+			name:              "build pod counted if not ignored",
+			ignoredOwnerKinds: []string{},
+			pod: func() *kapi.Pod {
+				pod := fakePod("pod1", tm(2017, time.January, 1))
+				pod.Annotations["openshift.io/build.name"] = "build1"
+				return pod
+			},
+			expected: tm(2017, time.January, 1),
+		},
+		{
+			name:              "owner reference ignored",
+			ignoredOwnerKinds: []string{"DaemonSet"},
+			pod: func() *kapi.Pod {
+				pod := fakePod("pod1", tm(2017, time.January, 1))
+				pod.OwnerReferences = []kapi.OwnerReference{
+					{Kind: "DaemonSet", Name: "logging", Controller: &controller},
+				}
+				return pod
+			},
+		},
+		{
+			name:              "created by annotation ignored",
+			ignoredOwnerKinds: []string{"DaemonSet"},
+			pod: func() *kapi.Pod {
+				pod := fakePod("pod1", tm(2017, time.January, 1))
+				pod.Annotations["kubernetes.io/created-by"] =
+					`{"kind":"SerializedReference","apiVersion":"v1","reference":{"kind":"DaemonSet","name":"logging"}}`
+				return pod
+			},
+		},
+		{
+			name:              "other owner counted",
+			ignoredOwnerKinds: []string{"DaemonSet"},
+			pod: func() *kapi.Pod {
+				pod := fakePod("pod1", tm(2017, time.January, 1))
+				pod.OwnerReferences = []kapi.OwnerReference{
+					{Kind: "ReplicaSet", Name: "frontend-1234", Controller: &controller},
+				}
+				return pod
+			},
+			expected: tm(2017, time.January, 1),
+		},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			aConfig := config.NewDefaultArchivistConfig()
+			if tc.ignoredOwnerKinds != nil {
+				aConfig.Clusters[0].PodActivity.IgnoredOwnerKinds = tc.ignoredOwnerKinds
+			}
+			cm, err := NewClusterMonitor(aConfig, aConfig.Clusters[0], &otestclient.Fake{}, &ktestclient.Clientset{},
+				(&fakebuildclient.Clientset{}).Core(), nil, nil)
+			if !assert.Nil(t, err) {
+				return
+			}
+			sourceObjects(cm, PodsActivitySource).Add(tc.pod())
+
+			lastActivity, err := cm.getLastActivity("ns", tm(2017, time.May, 29))
+			if assert.Nil(t, err) {
+				assert.Equal(t, tc.expected, lastActivity)
+			}
+		})
+	}
+}
@@ -0,0 +1,99 @@
+package clustermonitor
+
+import (
+	"fmt"
+	"path"
+	"regexp"
+	"strings"
+
+	"github.com/openshift/online/archivist/pkg/config"
+
+	kapi "k8s.io/kubernetes/pkg/api"
+	"k8s.io/kubernetes/pkg/labels"
+)
+
+// protectionRules decides which namespaces can never be archived.
+type protectionRules struct {
+	names       []string
+	patterns    []string
+	regexps     []*regexp.Regexp
+	selectors   []labels.Selector
+	annotations []annotationRule
+}
+
+// annotationRule matches namespaces with an annotation, with any value if value is not set.
+type annotationRule struct {
+	key      string
+	value    string
+	hasValue bool
+}
+
+func newProtectionRules(cc config.ClusterConfig) (*protectionRules, error) {
+	cfg := cc.ProtectedNamespaceRules
+	r := &protectionRules{
+		names:    cc.ProtectedNamespaces,
+		patterns: cfg.Patterns,
+	}
+	for _, expr := range cfg.Regexps {
+		// Must match the whole name:
+		re, err := regexp.Compile("^(?:" + expr + ")$")
+		if err != nil {
+			return nil, fmt.Errorf("invalid protected namespace regexp %s: %s", expr, err)
+		}
+		r.regexps = append(r.regexps, re)
+	}
+	for _, s := range cfg.LabelSelectors {
+		selector, err := labels.Parse(s)
+		if err != nil {
+			return nil, fmt.Errorf("invalid protected namespace label selector %s: %s", s, err)
+		}
+		r.selectors = append(r.selectors, selector)
+	}
+	for _, a := range cfg.Annotations {
+		parts := strings.SplitN(a, "=", 2)
+		rule := annotationRule{key: parts[0]}
+		if len(parts) == 2 {
+			rule.value = parts[1]
+			rule.hasValue = true
+		}
+		r.annotations = append(r.annotations, rule)
+	}
+	return r, nil
+}
+
+// protectedName returns the rule protecting a namespace by name alone, or false if none does.
+func (r *protectionRules) protectedName(name string) (string, bool) {
+	if stringInSlice(name, r.names) {
+		return "protectedNamespaces", true
+	}
+	for _, pattern := range r.patterns {
+		if ok, _ := path.Match(pattern, name); ok {
+			return "pattern " + pattern, true
+		}
+	}
+	for _, re := range r.regexps {
+		if re.MatchString(name) {
+			return "regexp " + re.String(), true
+		}
+	}
+	return "", false
+}
+
+// protected returns the rule protecting a namespace, or false if none does.
+func (r *protectionRules) protected(namespace *kapi.Namespace) (string, bool) {
+	if rule, ok := r.protectedName(namespace.Name); ok {
+		return rule, true
+	}
+	for _, selector := range r.selectors {
+		if selector.Matches(labels.Set(namespace.Labels)) {
+			return "label selector " + selector.String(), true
+		}
+	}
+	for _, rule := range r.annotations {
+		value, ok := namespace.Annotations[rule.key]
+		if ok && (!rule.hasValue || value == rule.value) {
+			return "annotation " + rule.key, true
+		}
+	}
+	return "", false
+}
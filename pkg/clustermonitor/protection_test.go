@@ -0,0 +1,94 @@
+package clustermonitor
+
+import (
+	"testing"
+
+	"github.com/openshift/online/archivist/pkg/config"
+
+	kapi "k8s.io/kubernetes/pkg/api"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestProtectionRules(t *testing.T) {
+	cc := config.NewDefaultArchivistConfig().Clusters[0]
+	cc.ProtectedNamespaceRules.Regexps = []string{"ops-[0-9]+"}
+	cc.ProtectedNamespaceRules.LabelSelectors = []string{"archivist.openshift.io/protected", "tier in (infra)"}
+	cc.ProtectedNamespaceRules.Annotations = []string{"openshift.io/requester=system:admin", "example.com/keep"}
+	rules, err := newProtectionRules(cc)
+	if !assert.Nil(t, err) {
+		return
+	}
+
+	tests := []struct {
+		name        string
+		namespace   string
+		labels      map[string]string
+		annotations map[string]string
+		protected   bool
+	}{
+		{name: "protected namespace", namespace: "default", protected: true},
+		{name: "default pattern", namespace: "openshift-logging", protected: true},
+		{name: "default exact pattern", namespace: "openshift", protected: true},
+		{name: "kube pattern", namespace: "kube-system", protected: true},
+		{name: "regexp", namespace: "ops-12", protected: true},
+		{name: "regexp matches whole name", namespace: "my-ops-12"},
+		{
+			name:      "label exists",
+			namespace: "ns1",
+			labels:    map[string]string{"archivist.openshift.io/protected": "yes"},
+			protected: true,
+		},
+		{
+			name:      "label value",
+			namespace: "ns1",
+			labels:    map[string]string{"tier": "infra"},
+			protected: true,
+		},
+		{
+			name:      "other label value",
+			namespace: "ns1",
+			labels:    map[string]string{"tier": "frontend"},
+		},
+		{
+			name:        "annotation value",
+			namespace:   "ns1",
+			annotations: map[string]string{"openshift.io/requester": "system:admin"},
+			protected:   true,
+		},
+		{
+			name:        "other annotation value",
+			namespace:   "ns1",
+			annotations: map[string]string{"openshift.io/requester": "user1"},
+		},
+		{
+			name:        "annotation exists",
+			namespace:   "ns1",
+			annotations: map[string]string{"example.com/keep": ""},
+			protected:   true,
+		},
+		{name: "unprotected", namespace: "openshifty"},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			ns := &kapi.Namespace{
+				ObjectMeta: kapi.ObjectMeta{
+					Name:        tc.namespace,
+					Labels:      tc.labels,
+					Annotations: tc.annotations,
+				},
+			}
+			_, protected := rules.protected(ns)
+			assert.Equal(t, tc.protected, protected)
+		})
+	}
+}
+
+func TestInvalidProtectionLabelSelector(t *testing.T) {
+	cc := config.NewDefaultArchivistConfig().Clusters[0]
+	cc.ProtectedNamespaceRules.LabelSelectors = []string{"tier in (infra"}
+	_, err := newProtectionRules(cc)
+	if assert.NotNil(t, err) {
+		assert.Contains(t, err.Error(), "invalid protected namespace label selector")
+	}
+}
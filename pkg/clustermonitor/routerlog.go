@@ -0,0 +1,244 @@
+package clustermonitor
+
+import (
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/openshift/online/archivist/pkg/activitystore"
+	"github.com/openshift/online/archivist/pkg/config"
+	"github.com/openshift/online/archivist/pkg/tail"
+
+	routeapi "github.com/openshift/origin/pkg/route/api"
+
+	log "github.com/Sirupsen/logrus"
+	kapi "k8s.io/kubernetes/pkg/api"
+	kcache "k8s.io/kubernetes/pkg/client/cache"
+	"k8s.io/kubernetes/pkg/runtime"
+	"k8s.io/kubernetes/pkg/watch"
+)
+
+// RouterLogActivitySource is the activity source for requests to routes, read from HAProxy router access logs. It
+// is disabled by default, as the routers must be configured to log to the archivist.
+const RouterLogActivitySource = "routerlog"
+
+const (
+	routerLogPollInterval = time.Second
+	// syslogRetryInterval is how long to wait before listening again after the syslog listener fails:
+	syslogRetryInterval = 30 * time.Second
+	// maxSyslogMessageSize is the largest syslog message accepted, longer messages are truncated:
+	maxSyslogMessageSize = 64 * 1024
+)
+
+// routeHostIndex indexes routes by their lower case host name.
+const routeHostIndex = "host"
+
+func init() {
+	RegisterActivitySource(RouterLogActivitySource, false, func(ctx ActivitySourceContext) (ActivitySource, error) {
+		cfg := ctx.ClusterConfig.RouterLog
+		if cfg.Path == "" && cfg.SyslogAddress == "" {
+			return nil, fmt.Errorf("routerLog path or syslogAddress must be set")
+		}
+		routes := kcache.NewSharedIndexInformer(
+			&kcache.ListWatch{
+				ListFunc: func(options kapi.ListOptions) (runtime.Object, error) {
+					return ctx.OC.Routes(kapi.NamespaceAll).List(options)
+				},
+				WatchFunc: func(options kapi.ListOptions) (watch.Interface, error) {
+					return ctx.OC.Routes(kapi.NamespaceAll).Watch(options)
+				},
+			},
+			&routeapi.Route{},
+			0, // not currently doing any re-syncing
+			kcache.Indexers{
+				kcache.NamespaceIndex: kcache.MetaNamespaceIndexFunc,
+				routeHostIndex:        routeHostIndexFunc,
+			},
+		)
+		return newRouterLogSource(ctx.ClusterConfig.Name, cfg, routes, ctx.Store)
+	})
+}
+
+func routeHostIndexFunc(obj interface{}) ([]string, error) {
+	route, ok := obj.(*routeapi.Route)
+	if !ok {
+		return nil, fmt.Errorf("expected a route, got %T", obj)
+	}
+	if route.Spec.Host == "" {
+		return []string{}, nil
+	}
+	return []string{strings.ToLower(route.Spec.Host)}, nil
+}
+
+// routerLogSource records the last request to a route in each namespace. Requests are mapped to routes by their
+// captured Host header if possible, otherwise by the name of the backend which served them.
+type routerLogSource struct {
+	cfg    config.RouterLogConfig
+	routes kcache.SharedIndexInformer
+	// routeIndexer is the routes informer's indexer, replaced in tests:
+	routeIndexer kcache.Indexer
+	store        *activitystore.ClusterStore
+	// location is the timezone of the times in access logs:
+	location *time.Location
+	// ignoredStatusCodes are the statuses of requests which are not activity:
+	ignoredStatusCodes map[string]bool
+	// tailer reads the access log file, nil if access logs are received over syslog:
+	tailer *tail.Tailer
+	log    *log.Entry
+
+	mutex        sync.RWMutex
+	lastActivity map[string]Activity
+	// listening is set once the syslog listener has started:
+	listening bool
+}
+
+func newRouterLogSource(clusterName string, cfg config.RouterLogConfig, routes kcache.SharedIndexInformer,
+	store *activitystore.ClusterStore) (*routerLogSource, error) {
+
+	location, err := time.LoadLocation(cfg.Timezone)
+	if err != nil {
+		return nil, fmt.Errorf("invalid routerLog timezone %q: %s", cfg.Timezone, err)
+	}
+	s := &routerLogSource{
+		cfg:                cfg,
+		routes:             routes,
+		routeIndexer:       routes.GetIndexer(),
+		store:              store,
+		location:           location,
+		ignoredStatusCodes: map[string]bool{},
+		log: log.WithFields(log.Fields{
+			"cluster":   clusterName,
+			"component": logComponent,
+			"source":    RouterLogActivitySource,
+		}),
+		lastActivity: map[string]Activity{},
+	}
+	for _, code := range cfg.IgnoredStatusCodes {
+		s.ignoredStatusCodes[strconv.Itoa(code)] = true
+	}
+	if cfg.Path != "" {
+		s.tailer = tail.New(cfg.Path, routerLogPollInterval, s.handleLine)
+	}
+	return s, nil
+}
+
+func (s *routerLogSource) LastActivity(namespace string) (Activity, error) {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+	return s.lastActivity[namespace], nil
+}
+
+func (s *routerLogSource) forgetNamespace(namespace string) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	delete(s.lastActivity, namespace)
+}
+
+func (s *routerLogSource) Informers() []NamedInformer {
+	return []NamedInformer{{Name: "routes", Informer: s.routes}}
+}
+
+func (s *routerLogSource) Run(stopChan <-chan struct{}) {
+	if s.tailer != nil {
+		go s.tailer.Run(stopChan)
+	}
+	if s.cfg.SyslogAddress != "" {
+		go s.runSyslogListener(stopChan)
+	}
+}
+
+// HasSynced returns true once the access log file has been read up to where it ended when the source was run, or
+// once the syslog listener has started. Syslog has no past activity to catch up on.
+func (s *routerLogSource) HasSynced() bool {
+	if s.tailer != nil {
+		return s.tailer.HasSynced()
+	}
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+	return s.listening
+}
+
+// runSyslogListener receives access logs sent by routers over UDP syslog until stopChan is closed, listening again
+// if the listener fails.
+func (s *routerLogSource) runSyslogListener(stopChan <-chan struct{}) {
+	listenLog := s.log.WithFields(log.Fields{"address": s.cfg.SyslogAddress})
+	for {
+		conn, err := net.ListenPacket("udp", s.cfg.SyslogAddress)
+		if err != nil {
+			listenLog.Errorf("error listening for router access logs: %s", err)
+		} else {
+			listenLog.Infoln("listening for router access logs")
+			s.mutex.Lock()
+			s.listening = true
+			s.mutex.Unlock()
+			done := make(chan struct{})
+			go func() {
+				select {
+				case <-stopChan:
+				case <-done:
+				}
+				conn.Close()
+			}()
+			buf := make([]byte, maxSyslogMessageSize)
+			for {
+				n, _, err := conn.ReadFrom(buf)
+				if err != nil {
+					select {
+					case <-stopChan:
+					default:
+						listenLog.Errorf("error reading router access logs: %s", err)
+					}
+					break
+				}
+				s.handleLine(strings.TrimRight(string(buf[:n]), "\r\n"))
+			}
+			close(done)
+		}
+		select {
+		case <-stopChan:
+			return
+		case <-time.After(syslogRetryInterval):
+		}
+	}
+}
+
+func (s *routerLogSource) handleLine(line string) {
+	entry, ok := parseAccessLog(line, s.location)
+	if !ok {
+		s.log.Debugf("ignoring line which is not an HTTP access log: %s", line)
+		return
+	}
+	if s.ignoredStatusCodes[entry.Status] {
+		return
+	}
+	namespace, route, ok := s.routeFor(entry)
+	if !ok {
+		return
+	}
+	activity := Activity{Time: entry.Time, Kind: "Route", Name: route}
+	storeActivity(s.store, RouterLogActivitySource, namespace, activity)
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if activity.Time.After(s.lastActivity[namespace].Time) {
+		s.lastActivity[namespace] = activity
+	}
+}
+
+// routeFor returns the namespace and name of the route which received a request, or false if it cannot be found.
+func (s *routerLogSource) routeFor(entry accessLogEntry) (string, string, bool) {
+	if entry.Host != "" {
+		objs, err := s.routeIndexer.ByIndex(routeHostIndex, entry.Host)
+		if err != nil {
+			s.log.Errorf("error looking up route for host %s: %s", entry.Host, err)
+		}
+		// Hosts can only be claimed by routes in a single namespace, so any route for the host will do:
+		if len(objs) > 0 {
+			route := objs[0].(*routeapi.Route)
+			return route.Namespace, route.Name, true
+		}
+	}
+	return parseRouterBackend(entry.Backend)
+}
@@ -0,0 +1,76 @@
+package clustermonitor
+
+import (
+	"testing"
+	"time"
+
+	"github.com/openshift/online/archivist/pkg/config"
+
+	routeapi "github.com/openshift/origin/pkg/route/api"
+
+	kapi "k8s.io/kubernetes/pkg/api"
+	kcache "k8s.io/kubernetes/pkg/client/cache"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRouterLogActivity(t *testing.T) {
+	routes := kcache.NewSharedIndexInformer(&kcache.ListWatch{}, &routeapi.Route{}, 0,
+		kcache.Indexers{routeHostIndex: routeHostIndexFunc})
+	s, err := newRouterLogSource("test cluster", config.RouterLogConfig{
+		Path:               "/unused",
+		Timezone:           "America/New_York",
+		IgnoredStatusCodes: []int{503},
+	}, routes, nil)
+	if !assert.Nil(t, err) {
+		return
+	}
+	s.routeIndexer.Add(&routeapi.Route{
+		ObjectMeta: kapi.ObjectMeta{Namespace: "ns1", Name: "www"},
+		Spec:       routeapi.RouteSpec{Host: "www.example.com"},
+	})
+
+	lines := []string{
+		// Mapped by host:
+		`10.0.1.2:33317 [29/May/2017:12:00:00.000] fe_sni be_secure:ns1:www/pod 10/0/30/69/109 200 2750 - - ---- 1/1/1/1/0 0/0 {www.example.com} "GET / HTTP/1.1"`,
+		// Mapped by backend, as the host has no route:
+		`10.0.1.2:33317 [29/May/2017:13:00:00.000] public be_http:ns2:api/pod 10/0/30/69/109 200 2750 - - ---- 1/1/1/1/0 0/0 {api.example.com} "GET / HTTP/1.1"`,
+		// Older requests do not replace newer:
+		`10.0.1.2:33317 [28/May/2017:12:00:00.000] public be_http:ns2:other/pod 10/0/30/69/109 200 2750 - - ---- 1/1/1/1/0 0/0 "GET / HTTP/1.1"`,
+		// Ignored, the route has no running pods:
+		`10.0.1.2:33317 [29/May/2017:15:00:00.000] public be_http:ns1:www/<NOSRV> 0/-1/-1/-1/0 503 3278 - - SC-- 1/1/0/0/0 0/0 {www.example.com} "GET / HTTP/1.1"`,
+		// Ignored:
+		`10.0.1.2:33317 [29/May/2017:14:00:00.000] public openshift_default/<NOSRV> 0/-1/-1/-1/0 503 3278 - - SC-- 1/1/0/0/0 0/0 {unknown.example.com} "GET / HTTP/1.1"`,
+		`not an access log`,
+	}
+	for _, line := range lines {
+		s.handleLine(line)
+	}
+
+	// Times are logged in the routers' timezone, 4 hours behind UTC in May:
+	tests := []struct {
+		namespace string
+		expected  Activity
+	}{
+		{
+			namespace: "ns1",
+			expected:  Activity{Time: time.Date(2017, time.May, 29, 16, 0, 0, 0, time.UTC), Kind: "Route", Name: "www"},
+		},
+		{
+			namespace: "ns2",
+			expected:  Activity{Time: time.Date(2017, time.May, 29, 17, 0, 0, 0, time.UTC), Kind: "Route", Name: "api"},
+		},
+		{
+			namespace: "ns3",
+		},
+	}
+	for _, tc := range tests {
+		activity, err := s.LastActivity(tc.namespace)
+		if assert.Nil(t, err) {
+			assert.True(t, tc.expected.Time.Equal(activity.Time), "%s: expected %s, got %s", tc.namespace,
+				tc.expected.Time, activity.Time)
+			assert.Equal(t, tc.expected.Kind, activity.Kind, tc.namespace)
+			assert.Equal(t, tc.expected.Name, activity.Name, tc.namespace)
+		}
+	}
+}
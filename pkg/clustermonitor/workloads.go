@@ -0,0 +1,250 @@
+package clustermonitor
+
+import (
+	"time"
+
+	buildapi "github.com/openshift/origin/pkg/build/api"
+	deployapi "github.com/openshift/origin/pkg/deploy/api"
+	imageapi "github.com/openshift/origin/pkg/image/api"
+
+	kapi "k8s.io/kubernetes/pkg/api"
+	"k8s.io/kubernetes/pkg/apis/apps"
+	"k8s.io/kubernetes/pkg/apis/batch"
+	"k8s.io/kubernetes/pkg/apis/extensions"
+	kcache "k8s.io/kubernetes/pkg/client/cache"
+	"k8s.io/kubernetes/pkg/runtime"
+	"k8s.io/kubernetes/pkg/watch"
+)
+
+// The built in activity sources for workloads, all enabled by default:
+const (
+	BuildsActivitySource                 = "builds"
+	ReplicationControllersActivitySource = "replicationcontrollers"
+	DeploymentConfigsActivitySource      = "deploymentconfigs"
+	DeploymentsActivitySource            = "deployments"
+	ReplicaSetsActivitySource            = "replicasets"
+	StatefulSetsActivitySource           = "statefulsets"
+	DaemonSetsActivitySource             = "daemonsets"
+	JobsActivitySource                   = "jobs"
+	ImageStreamsActivitySource           = "imagestreams"
+)
+
+func init() {
+	RegisterActivitySource(BuildsActivitySource, true, func(ctx ActivitySourceContext) (ActivitySource, error) {
+		// TODO: Currently targetting 1.5 but for 1.6, deads2k suggests switching to SharedInformerFactory from
+		// https://github.com/openshift/origin/blob/master/pkg/build/generated/informers/internalversion/factory.go#L29
+		// Then using .Build().Builds().AddResourceEventHandler()
+		informer := newNamespacedInformer(
+			func(options kapi.ListOptions) (runtime.Object, error) {
+				return ctx.BC.Builds(kapi.NamespaceAll).List(options)
+			},
+			func(options kapi.ListOptions) (watch.Interface, error) {
+				return ctx.BC.Builds(kapi.NamespaceAll).Watch(options)
+			},
+			&buildapi.Build{},
+		)
+		return newInformerSource(ctx, BuildsActivitySource, "Build", informer, buildActivity)
+	})
+	RegisterActivitySource(ReplicationControllersActivitySource, true, func(ctx ActivitySourceContext) (ActivitySource, error) {
+		informer := newNamespacedInformer(
+			func(options kapi.ListOptions) (runtime.Object, error) {
+				return ctx.KC.Core().ReplicationControllers(kapi.NamespaceAll).List(options)
+			},
+			func(options kapi.ListOptions) (watch.Interface, error) {
+				return ctx.KC.Core().ReplicationControllers(kapi.NamespaceAll).Watch(options)
+			},
+			&kapi.ReplicationController{},
+		)
+		return newInformerSource(ctx, ReplicationControllersActivitySource, "ReplicationController", informer,
+			creationActivity)
+	})
+	RegisterActivitySource(DeploymentConfigsActivitySource, true, func(ctx ActivitySourceContext) (ActivitySource, error) {
+		informer := newNamespacedInformer(
+			func(options kapi.ListOptions) (runtime.Object, error) {
+				return ctx.OC.DeploymentConfigs(kapi.NamespaceAll).List(options)
+			},
+			func(options kapi.ListOptions) (watch.Interface, error) {
+				return ctx.OC.DeploymentConfigs(kapi.NamespaceAll).Watch(options)
+			},
+			&deployapi.DeploymentConfig{},
+		)
+		return newInformerSource(ctx, DeploymentConfigsActivitySource, "DeploymentConfig", informer,
+			deploymentConfigActivity)
+	})
+	RegisterActivitySource(DeploymentsActivitySource, true, func(ctx ActivitySourceContext) (ActivitySource, error) {
+		informer := newNamespacedInformer(
+			func(options kapi.ListOptions) (runtime.Object, error) {
+				return ctx.KC.Extensions().Deployments(kapi.NamespaceAll).List(options)
+			},
+			func(options kapi.ListOptions) (watch.Interface, error) {
+				return ctx.KC.Extensions().Deployments(kapi.NamespaceAll).Watch(options)
+			},
+			&extensions.Deployment{},
+		)
+		return newInformerSource(ctx, DeploymentsActivitySource, "Deployment", informer, deploymentActivity)
+	})
+	RegisterActivitySource(ReplicaSetsActivitySource, true, func(ctx ActivitySourceContext) (ActivitySource, error) {
+		informer := newNamespacedInformer(
+			func(options kapi.ListOptions) (runtime.Object, error) {
+				return ctx.KC.Extensions().ReplicaSets(kapi.NamespaceAll).List(options)
+			},
+			func(options kapi.ListOptions) (watch.Interface, error) {
+				return ctx.KC.Extensions().ReplicaSets(kapi.NamespaceAll).Watch(options)
+			},
+			&extensions.ReplicaSet{},
+		)
+		return newInformerSource(ctx, ReplicaSetsActivitySource, "ReplicaSet", informer, creationActivity)
+	})
+	RegisterActivitySource(StatefulSetsActivitySource, true, func(ctx ActivitySourceContext) (ActivitySource, error) {
+		informer := newNamespacedInformer(
+			func(options kapi.ListOptions) (runtime.Object, error) {
+				return ctx.KC.Apps().StatefulSets(kapi.NamespaceAll).List(options)
+			},
+			func(options kapi.ListOptions) (watch.Interface, error) {
+				return ctx.KC.Apps().StatefulSets(kapi.NamespaceAll).Watch(options)
+			},
+			&apps.StatefulSet{},
+		)
+		return newInformerSource(ctx, StatefulSetsActivitySource, "StatefulSet", informer, creationActivity)
+	})
+	RegisterActivitySource(DaemonSetsActivitySource, true, func(ctx ActivitySourceContext) (ActivitySource, error) {
+		informer := newNamespacedInformer(
+			func(options kapi.ListOptions) (runtime.Object, error) {
+				return ctx.KC.Extensions().DaemonSets(kapi.NamespaceAll).List(options)
+			},
+			func(options kapi.ListOptions) (watch.Interface, error) {
+				return ctx.KC.Extensions().DaemonSets(kapi.NamespaceAll).Watch(options)
+			},
+			&extensions.DaemonSet{},
+		)
+		return newInformerSource(ctx, DaemonSetsActivitySource, "DaemonSet", informer, creationActivity)
+	})
+	RegisterActivitySource(JobsActivitySource, true, func(ctx ActivitySourceContext) (ActivitySource, error) {
+		informer := newNamespacedInformer(
+			func(options kapi.ListOptions) (runtime.Object, error) {
+				return ctx.KC.Batch().Jobs(kapi.NamespaceAll).List(options)
+			},
+			func(options kapi.ListOptions) (watch.Interface, error) {
+				return ctx.KC.Batch().Jobs(kapi.NamespaceAll).Watch(options)
+			},
+			&batch.Job{},
+		)
+		return newInformerSource(ctx, JobsActivitySource, "Job", informer, jobActivity)
+	})
+	RegisterActivitySource(ImageStreamsActivitySource, true, func(ctx ActivitySourceContext) (ActivitySource, error) {
+		informer := newNamespacedInformer(
+			func(options kapi.ListOptions) (runtime.Object, error) {
+				return ctx.OC.ImageStreams(kapi.NamespaceAll).List(options)
+			},
+			func(options kapi.ListOptions) (watch.Interface, error) {
+				return ctx.OC.ImageStreams(kapi.NamespaceAll).Watch(options)
+			},
+			&imageapi.ImageStream{},
+		)
+		return newInformerSource(ctx, ImageStreamsActivitySource, "ImageStream", informer, imageStreamActivity)
+	})
+}
+
+// newNamespacedInformer returns an informer for every object of a namespaced resource, indexed by namespace.
+func newNamespacedInformer(listFunc kcache.ListFunc, watchFunc kcache.WatchFunc,
+	objType runtime.Object) kcache.SharedIndexInformer {
+
+	return kcache.NewSharedIndexInformer(
+		&kcache.ListWatch{ListFunc: listFunc, WatchFunc: watchFunc},
+		objType,
+		0, // not currently doing any re-syncing
+		kcache.Indexers{
+			kcache.NamespaceIndex: kcache.MetaNamespaceIndexFunc,
+		},
+	)
+}
+
+// buildActivity is the start of the build. Builds may briefly have no start timestamp, they are ignored until
+// they do.
+func buildActivity(obj interface{}) time.Time {
+	b := obj.(*buildapi.Build)
+	if b.Status.StartTimestamp == nil {
+		return time.Time{}
+	}
+	return b.Status.StartTimestamp.Time
+}
+
+// creationActivity treats the creation of an object as its only activity. Used for kinds, like replica sets,
+// where a new object is created for each rollout.
+func creationActivity(obj interface{}) time.Time {
+	objMeta, err := kapi.ObjectMetaFor(obj.(runtime.Object))
+	if err != nil {
+		return time.Time{}
+	}
+	return objMeta.CreationTimestamp.Time
+}
+
+// Reasons for the Progressing condition of deployment configs and deployments when a rollout starts:
+const (
+	newReplicationControllerReason = "NewReplicationControllerCreated"
+	newReplicaSetReason            = "NewReplicaSetCreated"
+)
+
+// deploymentConfigActivity is the most recent of the creation of the deployment config and the start of its last
+// rollout. Other conditions, such as Available, change whenever pods fail or recover, so are not activity.
+func deploymentConfigActivity(obj interface{}) time.Time {
+	dc := obj.(*deployapi.DeploymentConfig)
+	latest := dc.CreationTimestamp.Time
+	for _, c := range dc.Status.Conditions {
+		if c.Type == deployapi.DeploymentProgressing && c.Reason == newReplicationControllerReason {
+			latest = laterOf(latest, c.LastTransitionTime.Time)
+		}
+	}
+	return latest
+}
+
+// deploymentActivity is the most recent of the creation of the deployment and the start of its last rollout. Other
+// conditions, such as Available, change whenever pods fail or recover, so are not activity.
+func deploymentActivity(obj interface{}) time.Time {
+	d := obj.(*extensions.Deployment)
+	latest := d.CreationTimestamp.Time
+	for _, c := range d.Status.Conditions {
+		if c.Type == extensions.DeploymentProgressing && c.Reason == newReplicaSetReason {
+			latest = laterOf(latest, c.LastUpdateTime.Time)
+			latest = laterOf(latest, c.LastTransitionTime.Time)
+		}
+	}
+	return latest
+}
+
+// jobActivity is the most recent of the creation, start and completion of the job.
+func jobActivity(obj interface{}) time.Time {
+	j := obj.(*batch.Job)
+	latest := j.CreationTimestamp.Time
+	if j.Status.StartTime != nil {
+		latest = laterOf(latest, j.Status.StartTime.Time)
+	}
+	if j.Status.CompletionTime != nil {
+		latest = laterOf(latest, j.Status.CompletionTime.Time)
+	}
+	return latest
+}
+
+// imageStreamActivity is the most recent entry in the history of any tag of the image stream, added by pushes to the
+// integrated registry as well as builds and imports. Tags with scheduled imports are ignored, as their history is
+// updated whenever the upstream image changes.
+func imageStreamActivity(obj interface{}) time.Time {
+	is := obj.(*imageapi.ImageStream)
+	var latest time.Time
+	for tag, history := range is.Status.Tags {
+		if ref, ok := is.Spec.Tags[tag]; ok && ref.ImportPolicy.Scheduled {
+			continue
+		}
+		for _, event := range history.Items {
+			latest = laterOf(latest, event.Created.Time)
+		}
+	}
+	return latest
+}
+
+func laterOf(a, b time.Time) time.Time {
+	if b.After(a) {
+		return b
+	}
+	return a
+}
@@ -3,12 +3,66 @@ package config
 import (
 	"fmt"
 	"io/ioutil"
+	"path"
+	"regexp"
+	"strings"
+	"time"
 
+	"github.com/robfig/cron"
 	"gopkg.in/yaml.v2"
 )
 
 var defaultProtectedNamespaces = []string{"default", "openshift-infra"}
 
+// defaultProtectedNamespacePatterns match the namespaces created by OpenShift and Kubernetes themselves.
+var defaultProtectedNamespacePatterns = []string{"openshift", "openshift-*", "kube-*"}
+
+// defaultIgnoredRouterStatusCodes are the statuses of responses generated by the router itself rather than an
+// application, such as 503 when a route has no endpoints.
+var defaultIgnoredRouterStatusCodes = []int{503}
+
+var defaultIgnoredPodOwnerKinds = []string{"Build", "Deployer"}
+
+// defaultEventReasons are the reasons for events which are triggered by users rolling out or scaling their
+// applications. Image pulls are not included as they also happen each time a container restarts, so a crash looping
+// pod would keep an abandoned namespace active.
+var defaultEventReasons = []string{"ScalingReplicaSet", "DeploymentCreated", "DeploymentCancelled"}
+
+const defaultArchiveDir = "/var/lib/archivist/archives"
+
+const defaultListenAddress = ":8080"
+
+const defaultActivityStorePath = "/var/lib/archivist/activity.db"
+
+const defaultActivityStoreFlushInterval = 30 * time.Second
+
+const defaultLivenessCheckMultiplier = 3
+
+const defaultCacheSyncTimeout = 10 * time.Minute
+
+const defaultCheckInterval = 5 * time.Minute
+
+const (
+	// FilesystemArchiveStore stores archives in a directory on the local filesystem.
+	FilesystemArchiveStore = "filesystem"
+	// S3ArchiveStore stores archives in a bucket of an S3 compatible object store.
+	S3ArchiveStore = "s3"
+)
+
+const (
+	defaultLeaderElectionNamespace     = "openshift-infra"
+	defaultLeaderElectionName          = "archivist-leader"
+	defaultLeaderElectionLeaseDuration = 15 * time.Second
+	defaultLeaderElectionRenewDeadline = 10 * time.Second
+	defaultLeaderElectionRetryPeriod   = 2 * time.Second
+)
+
+const (
+	defaultS3Region     = "us-east-1"
+	defaultS3PartSizeMB = 16
+	defaultS3Timeout    = 5 * time.Minute
+)
+
 type NamespaceCapacity struct {
 
 	// HighWatermark is the number of clusters that will trigger more aggressive archival.
@@ -19,11 +73,152 @@ type NamespaceCapacity struct {
 	LowWatermark int `yaml:"lowWatermark"`
 }
 
+const (
+	// KubeconfigConnection connects using a kubeconfig file.
+	KubeconfigConnection = "kubeconfig"
+	// InClusterConnection connects using the service account of the pod the archivist is running in.
+	InClusterConnection = "inCluster"
+	// TokenConnection connects to a server using a bearer token read from a file.
+	TokenConnection = "token"
+)
+
+// ClusterConnection configures how the archivist connects to a cluster.
+type ClusterConnection struct {
+	// Mode selects how to connect, defaulting to kubeconfig.
+	Mode string `yaml:"mode"`
+
+	// Kubeconfig is the path of a kubeconfig file to load, the default loading rules are used if unset.
+	Kubeconfig string `yaml:"kubeconfig"`
+	// Context is the kubeconfig context to use, rather than the current context.
+	Context string `yaml:"context"`
+
+	// Server is the URL of the API server for token connections.
+	Server string `yaml:"server"`
+	// TokenFile is the path of a file containing the bearer token for token connections.
+	TokenFile string `yaml:"tokenFile"`
+	// CAFile is the path of the CA bundle used to verify the server for token connections. The system roots
+	// are used if unset.
+	CAFile string `yaml:"caFile"`
+}
+
+// MaintenanceWindow is a period of the week during which namespaces may be archived.
+type MaintenanceWindow struct {
+	// Days the window applies to, e.g. "Mon" or "Monday". The window applies to every day if unset.
+	Days []string `yaml:"days"`
+	// Start and End are the times of day the window opens and closes, as "HH:MM". End may be "24:00".
+	Start string `yaml:"start"`
+	End   string `yaml:"end"`
+	// Timezone is the IANA name of the timezone the days and times are in, defaulting to UTC.
+	Timezone string `yaml:"timezone"`
+}
+
+// ScheduleConfig controls when capacity checks run for a cluster, and when namespaces may be archived.
+type ScheduleConfig struct {
+	// Interval between capacity checks, used if Cron is not set. Defaults to 5 minutes.
+	Interval time.Duration `yaml:"interval"`
+	// Cron is a standard five field cron expression, in UTC, for when capacity checks run.
+	Cron string `yaml:"cron"`
+	// MaintenanceWindows limits archival to the given periods. Capacity checks outside every window are still
+	// run and logged, but no namespace is archived. Archival is allowed at any time if unset.
+	MaintenanceWindows []MaintenanceWindow `yaml:"maintenanceWindows"`
+}
+
+// ActivitySourceConfig enables or disables, and weights, a source of namespace activity.
+type ActivitySourceConfig struct {
+	// Enabled overrides whether the source is used. Each source is enabled or disabled by default.
+	Enabled *bool `yaml:"enabled"`
+	// Weight scales how recent activity from the source appears, relative to the time of the capacity check.
+	// Activity from a source with a weight of 2 appears half as old as it really is, and with a weight of 0.5
+	// twice as old. Defaults to 1.
+	Weight float64 `yaml:"weight"`
+}
+
+// PodActivityConfig configures the pods activity source.
+type PodActivityConfig struct {
+	// IgnoredOwnerKinds lists the kinds of controller whose pods are not counted as activity, e.g. "DaemonSet".
+	// The owner of a pod is its controller owner reference, or the reference in its kubernetes.io/created-by
+	// annotation. Build pods have the owner kind "Build", and deployment and hook pods "Deployer". Defaults to
+	// ignoring build and deployer pods, whose activity is already counted by the builds and
+	// replicationcontrollers sources.
+	IgnoredOwnerKinds []string `yaml:"ignoredOwnerKinds"`
+}
+
+// EventActivityConfig configures the events activity source.
+type EventActivityConfig struct {
+	// Reasons lists the event reasons counted as activity, e.g. "ScalingReplicaSet". Defaults to the reasons for
+	// rollouts and scaling. An empty list counts events with any reason not in IgnoredReasons.
+	Reasons []string `yaml:"reasons"`
+	// IgnoredReasons lists event reasons which are never counted as activity, e.g. "BackOff".
+	IgnoredReasons []string `yaml:"ignoredReasons"`
+}
+
+// AuditLogConfig configures the auditlog activity source.
+type AuditLogConfig struct {
+	// Path of the API server audit log, written as JSON lines. Rotated logs are followed.
+	Path string `yaml:"path"`
+	// IgnoredUsers lists users whose requests are not counted as activity, in addition to system users whose
+	// names start with "system:", e.g. automation which updates every project.
+	IgnoredUsers []string `yaml:"ignoredUsers"`
+}
+
+// RouterLogConfig configures the routerlog activity source, which reads HAProxy router access logs either from a
+// file or received directly from the routers. Only one of Path and SyslogAddress may be set.
+type RouterLogConfig struct {
+	// Path of a file the access logs are written to, e.g. by a syslog daemon. Rotated logs are followed.
+	Path string `yaml:"path"`
+	// SyslogAddress is the UDP address to receive access logs on, e.g. ":5140". Routers send their logs to the
+	// address set in their ROUTER_SYSLOG_ADDRESS environment variable.
+	SyslogAddress string `yaml:"syslogAddress"`
+	// Timezone is the IANA name of the timezone of the routers' clocks, defaulting to UTC. HAProxy logs times
+	// without a timezone.
+	Timezone string `yaml:"timezone"`
+	// IgnoredStatusCodes are the HTTP statuses of requests which are not activity. Defaults to 503, which the router
+	// returns for routes with no running pods. An empty list counts requests with any status.
+	IgnoredStatusCodes []int `yaml:"ignoredStatusCodes"`
+}
+
+// EmptyNamespaceConfig controls the archival of namespaces in which no activity has been found. By default they are
+// never archived.
+type EmptyNamespaceConfig struct {
+	// UseCreationTime treats the creation of an empty namespace as its last activity, so it is archived under the
+	// same minInactiveDays and maxInactiveDays policy as other namespaces.
+	UseCreationTime bool `yaml:"useCreationTime"`
+	// MaxEmptyDays archives empty namespaces created more than this many days ago, whether or not the cluster is
+	// over capacity. Disabled if 0.
+	MaxEmptyDays int `yaml:"maxEmptyDays"`
+}
+
+// NamespaceAnnotationConfig controls the annotations which override the archival policy of individual namespaces.
+type NamespaceAnnotationConfig struct {
+	// AdminAnnotations lists the admin-only annotations which are honoured, e.g.
+	// archivist.openshift.io/archive-immediately. The archivist cannot tell who set an annotation, so only list those
+	// which namespace owners are not permitted to change. The exempt-until annotation is always honoured.
+	AdminAnnotations []string `yaml:"adminAnnotations"`
+	// MaxExemptDays limits how far ahead the exempt-until annotation may be set. Later dates are ignored. Disabled
+	// if 0.
+	MaxExemptDays int `yaml:"maxExemptDays"`
+}
+
+// NamespaceProtectionConfig protects namespaces from archival by rule, so that new system namespaces are protected
+// without listing each of them in protectedNamespaces.
+type NamespaceProtectionConfig struct {
+	// Patterns are shell patterns matched against namespace names, e.g. "openshift-*". Defaults to the OpenShift
+	// and Kubernetes system namespaces if not set.
+	Patterns []string `yaml:"patterns"`
+	// Regexps are regular expressions which must match the whole namespace name.
+	Regexps []string `yaml:"regexps"`
+	// LabelSelectors are label selectors matched against namespace labels, e.g. "archivist.openshift.io/protected".
+	LabelSelectors []string `yaml:"labelSelectors"`
+	// Annotations protect namespaces with the given annotation, either "key" or "key=value".
+	Annotations []string `yaml:"annotations"`
+}
+
 // ClusterConfig represents the settings for a specific cluster this instance of the archivist
 // will manage capacity for.
 type ClusterConfig struct {
 	// Name is a user specified name to identify a particular cluster being managed.
 	Name              string            `yaml:"name"`
+	Connection        ClusterConnection `yaml:"connection"`
 	NamespaceCapacity NamespaceCapacity `yaml:"namespaceCapacity"`
 	// You *may* be archived if inactive beyond than this number of days, if we need to reclaim space:
 	MinInactiveDays int `yaml:"minInactiveDays"`
@@ -31,11 +226,112 @@ type ClusterConfig struct {
 	MaxInactiveDays int `yaml:"maxInactiveDays"`
 	// Namespaces which can *never* be archived:
 	ProtectedNamespaces []string `yaml:"protectedNamespaces"`
+	// ProtectedNamespaceRules protects any namespace matching one of its rules:
+	ProtectedNamespaceRules NamespaceProtectionConfig `yaml:"protectedNamespaceRules"`
+	// ArchiveStore overrides the top level archive store for this cluster.
+	ArchiveStore *ArchiveStoreConfig `yaml:"archiveStore"`
+	Schedule     ScheduleConfig      `yaml:"schedule"`
+	// ActivitySources configures the sources of namespace activity by name, e.g. "builds". Sources not listed
+	// keep their default settings.
+	ActivitySources map[string]ActivitySourceConfig `yaml:"activitySources"`
+	PodActivity     PodActivityConfig               `yaml:"podActivity"`
+	EventActivity   EventActivityConfig             `yaml:"eventActivity"`
+	AuditLog        AuditLogConfig                  `yaml:"auditLog"`
+	RouterLog       RouterLogConfig                 `yaml:"routerLog"`
+	EmptyNamespaces EmptyNamespaceConfig            `yaml:"emptyNamespaces"`
+	// NamespaceAnnotations configures the archival policy overrides namespaces may carry.
+	NamespaceAnnotations NamespaceAnnotationConfig `yaml:"namespaceAnnotations"`
+}
+
+// FilesystemStoreConfig configures archive storage on the local filesystem.
+type FilesystemStoreConfig struct {
+	// Path is the directory archives are written to, one sub-directory per cluster.
+	Path string `yaml:"path"`
+}
+
+// S3StoreConfig configures archive storage in an S3 compatible object store.
+type S3StoreConfig struct {
+	// Endpoint is the URL of the S3 API, e.g. https://minio.example.com:9000.
+	Endpoint string `yaml:"endpoint"`
+	Region   string `yaml:"region"`
+	Bucket   string `yaml:"bucket"`
+	// Prefix is prepended to the key of every archive written to the bucket.
+	Prefix string `yaml:"prefix"`
+	// If not set, credentials are read from the AWS_ACCESS_KEY_ID and AWS_SECRET_ACCESS_KEY environment variables.
+	AccessKeyID     string `yaml:"accessKeyID"`
+	SecretAccessKey string `yaml:"secretAccessKey"`
+	// PartSizeMB is the size of each part of a multipart upload. Archives smaller than this are uploaded in
+	// a single request.
+	PartSizeMB int `yaml:"partSizeMB"`
+	// Timeout limits each request to the object store, including reading its response, so an unresponsive
+	// server cannot block archival indefinitely.
+	Timeout time.Duration `yaml:"timeout"`
+}
+
+// String avoids logging the secret access key along with the rest of the configuration.
+func (c S3StoreConfig) String() string {
+	redacted := c
+	if redacted.SecretAccessKey != "" {
+		redacted.SecretAccessKey = "<redacted>"
+	}
+	type plain S3StoreConfig
+	return fmt.Sprintf("%+v", plain(redacted))
+}
+
+// ArchiveStoreConfig selects the backend archives are stored in.
+type ArchiveStoreConfig struct {
+	// Type is the storage backend to use.
+	Type       string                `yaml:"type"`
+	Filesystem FilesystemStoreConfig `yaml:"filesystem"`
+	S3         S3StoreConfig         `yaml:"s3"`
+}
+
+// LeaderElectionConfig configures leader election between archivist replicas, so only one replica checks capacity
+// and archives each cluster at a time. Every replica monitors activity. The lock is a ConfigMap held in every managed
+// cluster.
+type LeaderElectionConfig struct {
+	Enabled bool `yaml:"enabled"`
+	// Namespace and Name of the lock ConfigMap.
+	Namespace string `yaml:"namespace"`
+	Name      string `yaml:"name"`
+	// LeaseDuration is how long other replicas wait after the last renewal before taking over.
+	LeaseDuration time.Duration `yaml:"leaseDuration"`
+	// RenewDeadline is how long the leader keeps trying to renew before it stops acting as leader.
+	RenewDeadline time.Duration `yaml:"renewDeadline"`
+	// RetryPeriod is the interval between attempts to acquire or renew leadership.
+	RetryPeriod time.Duration `yaml:"retryPeriod"`
+}
+
+// ActivityStoreConfig configures the file the last activity of each namespace is persisted to. With leader
+// election each replica keeps its own store, which cannot be shared as it is locked while open. Every replica,
+// including those on standby, tracks activity into its own store so a new leader has the same history as the old
+// one. Stores should be on volumes which survive the replica being rescheduled. Log based activity sources only see
+// the logs delivered to each replica, so router logs should be sent to every replica.
+type ActivityStoreConfig struct {
+	// Path of the store, created if it does not exist.
+	Path string `yaml:"path"`
+	// FlushInterval is how often activity is written to the store. Activity found since the last write is lost
+	// if the archivist is killed.
+	FlushInterval time.Duration `yaml:"flushInterval"`
 }
 
 type ArchivistConfig struct {
-	LogLevel string          `yaml:"logLevel"`
-	Clusters []ClusterConfig `yaml:"clusters"`
+	LogLevel     string             `yaml:"logLevel"`
+	Clusters     []ClusterConfig    `yaml:"clusters"`
+	ArchiveStore ArchiveStoreConfig `yaml:"archiveStore"`
+	// DryRun runs capacity checks and logs which namespaces would be archived, but never archives or
+	// deletes anything.
+	DryRun         bool                 `yaml:"dryRun"`
+	LeaderElection LeaderElectionConfig `yaml:"leaderElection"`
+	// ListenAddress is the address the HTTP server exposing /metrics, /healthz and /readyz listens on.
+	ListenAddress string `yaml:"listenAddress"`
+	// LivenessCheckMultiplier is the number of capacity check intervals which may pass without a check
+	// completing before /healthz reports the archivist as unhealthy.
+	LivenessCheckMultiplier int `yaml:"livenessCheckMultiplier"`
+	// CacheSyncTimeout is how long to wait for the informer caches of a cluster to sync before giving up and
+	// retrying the cluster.
+	CacheSyncTimeout time.Duration       `yaml:"cacheSyncTimeout"`
+	ActivityStore    ActivityStoreConfig `yaml:"activityStore"`
 }
 
 func NewArchivistConfigFromString(yamlConfig string) (ArchivistConfig, error) {
@@ -83,7 +379,53 @@ func ApplyConfigDefaults(cfg *ArchivistConfig) {
 	if cfg.LogLevel == "" {
 		cfg.LogLevel = "info"
 	}
+	if cfg.ListenAddress == "" {
+		cfg.ListenAddress = defaultListenAddress
+	}
+	if cfg.LivenessCheckMultiplier == 0 {
+		cfg.LivenessCheckMultiplier = defaultLivenessCheckMultiplier
+	}
+	if cfg.CacheSyncTimeout == 0 {
+		cfg.CacheSyncTimeout = defaultCacheSyncTimeout
+	}
+	if cfg.ActivityStore.Path == "" {
+		cfg.ActivityStore.Path = defaultActivityStorePath
+	}
+	if cfg.ActivityStore.FlushInterval == 0 {
+		cfg.ActivityStore.FlushInterval = defaultActivityStoreFlushInterval
+	}
+	applyArchiveStoreDefaults(&cfg.ArchiveStore)
+	if cfg.LeaderElection.Enabled {
+		applyLeaderElectionDefaults(&cfg.LeaderElection)
+	}
 	for i := range cfg.Clusters {
+		if cfg.Clusters[i].Connection.Mode == "" {
+			cfg.Clusters[i].Connection.Mode = KubeconfigConnection
+		}
+		if cfg.Clusters[i].ArchiveStore != nil {
+			applyArchiveStoreDefaults(cfg.Clusters[i].ArchiveStore)
+		}
+		if cfg.Clusters[i].Schedule.Interval == 0 && cfg.Clusters[i].Schedule.Cron == "" {
+			cfg.Clusters[i].Schedule.Interval = defaultCheckInterval
+		}
+		// An empty list, rather than none at all, ignores no pods:
+		if cfg.Clusters[i].PodActivity.IgnoredOwnerKinds == nil {
+			cfg.Clusters[i].PodActivity.IgnoredOwnerKinds = make([]string, len(defaultIgnoredPodOwnerKinds))
+			copy(cfg.Clusters[i].PodActivity.IgnoredOwnerKinds, defaultIgnoredPodOwnerKinds)
+		}
+		// Likewise an empty list counts events with any reason:
+		if cfg.Clusters[i].EventActivity.Reasons == nil {
+			cfg.Clusters[i].EventActivity.Reasons = make([]string, len(defaultEventReasons))
+			copy(cfg.Clusters[i].EventActivity.Reasons, defaultEventReasons)
+		}
+		if cfg.Clusters[i].RouterLog.IgnoredStatusCodes == nil {
+			cfg.Clusters[i].RouterLog.IgnoredStatusCodes = make([]int, len(defaultIgnoredRouterStatusCodes))
+			copy(cfg.Clusters[i].RouterLog.IgnoredStatusCodes, defaultIgnoredRouterStatusCodes)
+		}
+		if cfg.Clusters[i].ProtectedNamespaceRules.Patterns == nil {
+			cfg.Clusters[i].ProtectedNamespaceRules.Patterns = make([]string, len(defaultProtectedNamespacePatterns))
+			copy(cfg.Clusters[i].ProtectedNamespaceRules.Patterns, defaultProtectedNamespacePatterns)
+		}
 		if len(cfg.Clusters[i].ProtectedNamespaces) == 0 {
 			// TODO: is this re-use of a package var array safe?
 			cfg.Clusters[i].ProtectedNamespaces = make([]string, len(defaultProtectedNamespaces))
@@ -98,20 +440,269 @@ func ApplyConfigDefaults(cfg *ArchivistConfig) {
 	}
 }
 
+func applyArchiveStoreDefaults(cfg *ArchiveStoreConfig) {
+	if cfg.Type == "" {
+		cfg.Type = FilesystemArchiveStore
+	}
+	switch cfg.Type {
+	case FilesystemArchiveStore:
+		if cfg.Filesystem.Path == "" {
+			cfg.Filesystem.Path = defaultArchiveDir
+		}
+	case S3ArchiveStore:
+		if cfg.S3.Region == "" {
+			cfg.S3.Region = defaultS3Region
+		}
+		if cfg.S3.PartSizeMB == 0 {
+			cfg.S3.PartSizeMB = defaultS3PartSizeMB
+		}
+		if cfg.S3.Timeout == 0 {
+			cfg.S3.Timeout = defaultS3Timeout
+		}
+	}
+}
+
+func applyLeaderElectionDefaults(cfg *LeaderElectionConfig) {
+	if cfg.Namespace == "" {
+		cfg.Namespace = defaultLeaderElectionNamespace
+	}
+	if cfg.Name == "" {
+		cfg.Name = defaultLeaderElectionName
+	}
+	if cfg.LeaseDuration == 0 {
+		cfg.LeaseDuration = defaultLeaderElectionLeaseDuration
+	}
+	if cfg.RenewDeadline == 0 {
+		cfg.RenewDeadline = defaultLeaderElectionRenewDeadline
+	}
+	if cfg.RetryPeriod == 0 {
+		cfg.RetryPeriod = defaultLeaderElectionRetryPeriod
+	}
+}
+
+func validateLeaderElection(cfg *LeaderElectionConfig) error {
+	if !cfg.Enabled {
+		return nil
+	}
+	if cfg.LeaseDuration <= cfg.RenewDeadline {
+		return fmt.Errorf("leaderElection leaseDuration must be greater than renewDeadline")
+	}
+	if cfg.RenewDeadline <= cfg.RetryPeriod {
+		return fmt.Errorf("leaderElection renewDeadline must be greater than retryPeriod")
+	}
+	return nil
+}
+
+func validateSchedule(cfg *ScheduleConfig) error {
+	if cfg.Cron != "" {
+		if cfg.Interval != 0 {
+			return fmt.Errorf("schedule cannot specify both an interval and a cron expression")
+		}
+		if _, err := cron.ParseStandard(cfg.Cron); err != nil {
+			return fmt.Errorf("invalid schedule cron expression %q: %s", cfg.Cron, err)
+		}
+	} else if cfg.Interval < 0 {
+		return fmt.Errorf("schedule interval cannot be negative")
+	}
+	for _, w := range cfg.MaintenanceWindows {
+		for _, d := range w.Days {
+			if _, err := ParseWeekday(d); err != nil {
+				return err
+			}
+		}
+		start, err := ParseTimeOfDay(w.Start)
+		if err != nil {
+			return err
+		}
+		end, err := ParseTimeOfDay(w.End)
+		if err != nil {
+			return err
+		}
+		if end <= start {
+			return fmt.Errorf("maintenance window end %s must be after start %s", w.End, w.Start)
+		}
+		if _, err := time.LoadLocation(w.Timezone); err != nil {
+			return fmt.Errorf("invalid maintenance window timezone %q: %s", w.Timezone, err)
+		}
+	}
+	return nil
+}
+
+func validateEventActivity(cfg *EventActivityConfig) error {
+	for _, ignored := range cfg.IgnoredReasons {
+		for _, reason := range cfg.Reasons {
+			if ignored == reason {
+				return fmt.Errorf("event reason %s cannot be both counted and ignored", reason)
+			}
+		}
+	}
+	return nil
+}
+
+// validateNamespaceProtection checks the namespace name patterns and regular expressions. Label selectors are parsed
+// by the cluster monitor.
+func validateNamespaceProtection(cfg *NamespaceProtectionConfig) error {
+	for _, pattern := range cfg.Patterns {
+		if _, err := path.Match(pattern, ""); err != nil {
+			return fmt.Errorf("invalid protected namespace pattern %s: %s", pattern, err)
+		}
+	}
+	for _, expr := range cfg.Regexps {
+		if _, err := regexp.Compile(expr); err != nil {
+			return fmt.Errorf("invalid protected namespace regexp %s: %s", expr, err)
+		}
+	}
+	for _, annotation := range cfg.Annotations {
+		if strings.HasPrefix(annotation, "=") || annotation == "" {
+			return fmt.Errorf("invalid protected namespace annotation: %q", annotation)
+		}
+	}
+	return nil
+}
+
+// ParseWeekday parses the English name of a day of the week, either in full or abbreviated to three letters.
+func ParseWeekday(s string) (time.Weekday, error) {
+	for d := time.Sunday; d <= time.Saturday; d++ {
+		if strings.EqualFold(s, d.String()) || strings.EqualFold(s, d.String()[:3]) {
+			return d, nil
+		}
+	}
+	return time.Sunday, fmt.Errorf("invalid day of the week: %s", s)
+}
+
+// ParseTimeOfDay parses a time of day given as "HH:MM", returning the offset from midnight. "24:00" is accepted
+// as the end of the day.
+func ParseTimeOfDay(s string) (time.Duration, error) {
+	var hours, minutes int
+	if n, err := fmt.Sscanf(s, "%d:%d", &hours, &minutes); err != nil || n != 2 || len(s) != 5 {
+		return 0, fmt.Errorf("invalid time of day, expected HH:MM: %s", s)
+	}
+	if hours < 0 || minutes < 0 || minutes > 59 || hours > 24 || (hours == 24 && minutes != 0) {
+		return 0, fmt.Errorf("invalid time of day: %s", s)
+	}
+	return time.Duration(hours)*time.Hour + time.Duration(minutes)*time.Minute, nil
+}
+
+func validateConnection(conn *ClusterConnection) error {
+	kubeconfigSet := conn.Kubeconfig != "" || conn.Context != ""
+	tokenSet := conn.Server != "" || conn.TokenFile != "" || conn.CAFile != ""
+	switch conn.Mode {
+	case KubeconfigConnection:
+		if tokenSet {
+			return fmt.Errorf("kubeconfig connection cannot specify a server, tokenFile or caFile")
+		}
+	case InClusterConnection:
+		if kubeconfigSet || tokenSet {
+			return fmt.Errorf("inCluster connection cannot specify any other connection settings")
+		}
+	case TokenConnection:
+		if kubeconfigSet {
+			return fmt.Errorf("token connection cannot specify a kubeconfig or context")
+		}
+		if conn.Server == "" || conn.TokenFile == "" {
+			return fmt.Errorf("token connection must specify a server and tokenFile")
+		}
+	default:
+		return fmt.Errorf("invalid connection mode: %s", conn.Mode)
+	}
+	return nil
+}
+
+func validateArchiveStore(cfg *ArchiveStoreConfig) error {
+	switch cfg.Type {
+	case FilesystemArchiveStore:
+	case S3ArchiveStore:
+		if cfg.S3.Endpoint == "" {
+			return fmt.Errorf("s3 archive store must have an endpoint")
+		}
+		if cfg.S3.Bucket == "" {
+			return fmt.Errorf("s3 archive store must have a bucket")
+		}
+		if cfg.S3.PartSizeMB < 5 {
+			return fmt.Errorf("s3 partSizeMB must be at least 5")
+		}
+		if cfg.S3.Timeout < 0 {
+			return fmt.Errorf("s3 timeout cannot be negative")
+		}
+	default:
+		return fmt.Errorf("invalid archive store type: %s", cfg.Type)
+	}
+	return nil
+}
+
+// ClusterArchiveStore returns the archive store configuration to use for a cluster.
+func (cfg ArchivistConfig) ClusterArchiveStore(cc ClusterConfig) ArchiveStoreConfig {
+	if cc.ArchiveStore != nil {
+		return *cc.ArchiveStore
+	}
+	return cfg.ArchiveStore
+}
+
 func ValidateConfig(cfg *ArchivistConfig) error {
 	if len(cfg.Clusters) == 0 {
 		return fmt.Errorf("no clusters in config")
 	}
+	clusterNames := map[string]bool{}
 	for _, cc := range cfg.Clusters {
 		if cc.Name == "" {
 			return fmt.Errorf("cluster must have a name")
 		}
+		if clusterNames[cc.Name] {
+			return fmt.Errorf("duplicate cluster name: %s", cc.Name)
+		}
+		clusterNames[cc.Name] = true
+		if err := validateConnection(&cc.Connection); err != nil {
+			return fmt.Errorf("cluster %s: %s", cc.Name, err)
+		}
+		for name, source := range cc.ActivitySources {
+			if source.Weight < 0 {
+				return fmt.Errorf("cluster %s: activity source %s weight cannot be negative", cc.Name, name)
+			}
+		}
+		if err := validateSchedule(&cc.Schedule); err != nil {
+			return fmt.Errorf("cluster %s: %s", cc.Name, err)
+		}
+		if err := validateEventActivity(&cc.EventActivity); err != nil {
+			return fmt.Errorf("cluster %s: %s", cc.Name, err)
+		}
+		if err := validateNamespaceProtection(&cc.ProtectedNamespaceRules); err != nil {
+			return fmt.Errorf("cluster %s: %s", cc.Name, err)
+		}
+		if cc.RouterLog.Path != "" && cc.RouterLog.SyslogAddress != "" {
+			return fmt.Errorf("cluster %s: routerLog cannot set both path and syslogAddress", cc.Name)
+		}
+		if _, err := time.LoadLocation(cc.RouterLog.Timezone); err != nil {
+			return fmt.Errorf("cluster %s: invalid routerLog timezone %q: %s", cc.Name, cc.RouterLog.Timezone, err)
+		}
+		if cc.EmptyNamespaces.MaxEmptyDays < 0 {
+			return fmt.Errorf("cluster %s: emptyNamespaces maxEmptyDays cannot be negative", cc.Name)
+		}
+		if cc.NamespaceAnnotations.MaxExemptDays < 0 {
+			return fmt.Errorf("cluster %s: namespaceAnnotations maxExemptDays cannot be negative", cc.Name)
+		}
 		if cc.MaxInactiveDays < cc.MinInactiveDays {
 			return fmt.Errorf("maxInactiveDays must be greater than minInactiveDays")
 		}
+		if cc.ArchiveStore != nil {
+			if err := validateArchiveStore(cc.ArchiveStore); err != nil {
+				return fmt.Errorf("cluster %s: %s", cc.Name, err)
+			}
+		}
 	}
 	if cfg.LogLevel == "" {
 		return fmt.Errorf("invalid log level: %s", cfg.LogLevel)
 	}
-	return nil
+	if cfg.LivenessCheckMultiplier < 1 {
+		return fmt.Errorf("livenessCheckMultiplier must be at least 1")
+	}
+	if cfg.CacheSyncTimeout < 0 {
+		return fmt.Errorf("cacheSyncTimeout cannot be negative")
+	}
+	if cfg.ActivityStore.FlushInterval < 0 {
+		return fmt.Errorf("activityStore flushInterval cannot be negative")
+	}
+	if err := validateLeaderElection(&cfg.LeaderElection); err != nil {
+		return err
+	}
+	return validateArchiveStore(&cfg.ArchiveStore)
 }
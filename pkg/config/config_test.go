@@ -3,6 +3,7 @@ package config
 import (
 	"strings"
 	"testing"
+	"time"
 
 	log "github.com/Sirupsen/logrus"
 	"github.com/stretchr/testify/assert"
@@ -20,6 +21,9 @@ func TestConfigParsing(t *testing.T) {
 			configStr: `---
 clusters:
 - name: test cluster
+  connection:
+    kubeconfig: /etc/archivist/kubeconfig
+    context: admin
   namespaceCapacity:
     highWatermark: 500
     lowWatermark: 400
@@ -30,11 +34,26 @@ clusters:
   - very-important
   - special
 logLevel: debug
+dryRun: true
+archiveStore:
+  type: filesystem
+  filesystem:
+    path: /archives
 `,
 			expectedConfig: ArchivistConfig{
 				Clusters: []ClusterConfig{
 					{
-						Name: "test cluster",
+						Name:                    "test cluster",
+						Schedule:                ScheduleConfig{Interval: 5 * time.Minute},
+						PodActivity:             PodActivityConfig{IgnoredOwnerKinds: []string{"Build", "Deployer"}},
+						EventActivity:           EventActivityConfig{Reasons: []string{"ScalingReplicaSet", "DeploymentCreated", "DeploymentCancelled"}},
+						RouterLog:               RouterLogConfig{IgnoredStatusCodes: []int{503}},
+						ProtectedNamespaceRules: NamespaceProtectionConfig{Patterns: []string{"openshift", "openshift-*", "kube-*"}},
+						Connection: ClusterConnection{
+							Mode:       "kubeconfig",
+							Kubeconfig: "/etc/archivist/kubeconfig",
+							Context:    "admin",
+						},
 						NamespaceCapacity: NamespaceCapacity{
 							HighWatermark: 500,
 							LowWatermark:  400,
@@ -45,7 +64,19 @@ logLevel: debug
 					},
 				},
 
-				LogLevel: "debug",
+				LogLevel:                "debug",
+				ListenAddress:           ":8080",
+				LivenessCheckMultiplier: 3,
+				CacheSyncTimeout:        10 * time.Minute,
+				ActivityStore: ActivityStoreConfig{
+					Path:          "/var/lib/archivist/activity.db",
+					FlushInterval: 30 * time.Second,
+				},
+				ArchiveStore: ArchiveStoreConfig{
+					Type:       "filesystem",
+					Filesystem: FilesystemStoreConfig{Path: "/archives"},
+				},
+				DryRun: true,
 			},
 		},
 		{
@@ -57,7 +88,13 @@ clusters:
 			expectedConfig: ArchivistConfig{
 				Clusters: []ClusterConfig{
 					{
-						Name: "test cluster",
+						Name:                    "test cluster",
+						Schedule:                ScheduleConfig{Interval: 5 * time.Minute},
+						PodActivity:             PodActivityConfig{IgnoredOwnerKinds: []string{"Build", "Deployer"}},
+						EventActivity:           EventActivityConfig{Reasons: []string{"ScalingReplicaSet", "DeploymentCreated", "DeploymentCancelled"}},
+						RouterLog:               RouterLogConfig{IgnoredStatusCodes: []int{503}},
+						ProtectedNamespaceRules: NamespaceProtectionConfig{Patterns: []string{"openshift", "openshift-*", "kube-*"}},
+						Connection:              ClusterConnection{Mode: "kubeconfig"},
 						NamespaceCapacity: NamespaceCapacity{
 							HighWatermark: 0,
 							LowWatermark:  0,
@@ -67,7 +104,18 @@ clusters:
 						ProtectedNamespaces: []string{"default", "openshift-infra"},
 					},
 				},
-				LogLevel: "info",
+				LogLevel:                "info",
+				ListenAddress:           ":8080",
+				LivenessCheckMultiplier: 3,
+				CacheSyncTimeout:        10 * time.Minute,
+				ActivityStore: ActivityStoreConfig{
+					Path:          "/var/lib/archivist/activity.db",
+					FlushInterval: 30 * time.Second,
+				},
+				ArchiveStore: ArchiveStoreConfig{
+					Type:       "filesystem",
+					Filesystem: FilesystemStoreConfig{Path: "/var/lib/archivist/archives"},
+				},
 			},
 		},
 		{
@@ -81,6 +129,153 @@ clusters:
 `,
 			expectedErrContains: "maxInactiveDays",
 		},
+		{
+			name: "per cluster s3 archive store",
+			configStr: `---
+clusters:
+- name: test cluster
+  archiveStore:
+    type: s3
+    s3:
+      endpoint: https://minio.example.com:9000
+      bucket: archives
+      prefix: online
+- name: other cluster
+`,
+			expectedConfig: ArchivistConfig{
+				Clusters: []ClusterConfig{
+					{
+						Name:                    "test cluster",
+						Schedule:                ScheduleConfig{Interval: 5 * time.Minute},
+						PodActivity:             PodActivityConfig{IgnoredOwnerKinds: []string{"Build", "Deployer"}},
+						EventActivity:           EventActivityConfig{Reasons: []string{"ScalingReplicaSet", "DeploymentCreated", "DeploymentCancelled"}},
+						RouterLog:               RouterLogConfig{IgnoredStatusCodes: []int{503}},
+						ProtectedNamespaceRules: NamespaceProtectionConfig{Patterns: []string{"openshift", "openshift-*", "kube-*"}},
+						Connection:              ClusterConnection{Mode: "kubeconfig"},
+						ProtectedNamespaces:     []string{"default", "openshift-infra"},
+						ArchiveStore: &ArchiveStoreConfig{
+							Type: "s3",
+							S3: S3StoreConfig{
+								Endpoint:   "https://minio.example.com:9000",
+								Region:     "us-east-1",
+								Bucket:     "archives",
+								Prefix:     "online",
+								PartSizeMB: 16,
+								Timeout:    5 * time.Minute,
+							},
+						},
+					},
+					{
+						Name:                    "other cluster",
+						Schedule:                ScheduleConfig{Interval: 5 * time.Minute},
+						PodActivity:             PodActivityConfig{IgnoredOwnerKinds: []string{"Build", "Deployer"}},
+						EventActivity:           EventActivityConfig{Reasons: []string{"ScalingReplicaSet", "DeploymentCreated", "DeploymentCancelled"}},
+						RouterLog:               RouterLogConfig{IgnoredStatusCodes: []int{503}},
+						ProtectedNamespaceRules: NamespaceProtectionConfig{Patterns: []string{"openshift", "openshift-*", "kube-*"}},
+						Connection:              ClusterConnection{Mode: "kubeconfig"},
+						ProtectedNamespaces:     []string{"default", "openshift-infra"},
+					},
+				},
+				LogLevel:                "info",
+				ListenAddress:           ":8080",
+				LivenessCheckMultiplier: 3,
+				CacheSyncTimeout:        10 * time.Minute,
+				ActivityStore: ActivityStoreConfig{
+					Path:          "/var/lib/archivist/activity.db",
+					FlushInterval: 30 * time.Second,
+				},
+				ArchiveStore: ArchiveStoreConfig{
+					Type:       "filesystem",
+					Filesystem: FilesystemStoreConfig{Path: "/var/lib/archivist/archives"},
+				},
+			},
+		},
+		{
+			name: "s3 archive store without bucket",
+			configStr: `---
+clusters:
+- name: test cluster
+archiveStore:
+  type: s3
+  s3:
+    endpoint: https://minio.example.com:9000
+`,
+			expectedErrContains: "must have a bucket",
+		},
+		{
+			name: "leader election defaults",
+			configStr: `---
+clusters:
+- name: test cluster
+leaderElection:
+  enabled: true
+  leaseDuration: 30s
+`,
+			expectedConfig: ArchivistConfig{
+				Clusters: []ClusterConfig{
+					{
+						Name:                    "test cluster",
+						Schedule:                ScheduleConfig{Interval: 5 * time.Minute},
+						PodActivity:             PodActivityConfig{IgnoredOwnerKinds: []string{"Build", "Deployer"}},
+						EventActivity:           EventActivityConfig{Reasons: []string{"ScalingReplicaSet", "DeploymentCreated", "DeploymentCancelled"}},
+						RouterLog:               RouterLogConfig{IgnoredStatusCodes: []int{503}},
+						ProtectedNamespaceRules: NamespaceProtectionConfig{Patterns: []string{"openshift", "openshift-*", "kube-*"}},
+						Connection:              ClusterConnection{Mode: "kubeconfig"},
+						ProtectedNamespaces:     []string{"default", "openshift-infra"},
+					},
+				},
+				LogLevel:                "info",
+				ListenAddress:           ":8080",
+				LivenessCheckMultiplier: 3,
+				CacheSyncTimeout:        10 * time.Minute,
+				ActivityStore: ActivityStoreConfig{
+					Path:          "/var/lib/archivist/activity.db",
+					FlushInterval: 30 * time.Second,
+				},
+				ArchiveStore: ArchiveStoreConfig{
+					Type:       "filesystem",
+					Filesystem: FilesystemStoreConfig{Path: "/var/lib/archivist/archives"},
+				},
+				LeaderElection: LeaderElectionConfig{
+					Enabled:       true,
+					Namespace:     "openshift-infra",
+					Name:          "archivist-leader",
+					LeaseDuration: 30 * time.Second,
+					RenewDeadline: 10 * time.Second,
+					RetryPeriod:   2 * time.Second,
+				},
+			},
+		},
+		{
+			name: "leader election lease shorter than renew deadline",
+			configStr: `---
+clusters:
+- name: test cluster
+leaderElection:
+  enabled: true
+  leaseDuration: 5s
+`,
+			expectedErrContains: "leaseDuration must be greater than renewDeadline",
+		},
+		{
+			name: "negative liveness check multiplier",
+			configStr: `---
+clusters:
+- name: test cluster
+livenessCheckMultiplier: -1
+`,
+			expectedErrContains: "livenessCheckMultiplier must be at least 1",
+		},
+		{
+			name: "invalid archive store type",
+			configStr: `---
+clusters:
+- name: test cluster
+archiveStore:
+  type: tape
+`,
+			expectedErrContains: "invalid archive store type",
+		},
 		{
 			name: "no clusters defined",
 			configStr: `---
@@ -88,6 +283,417 @@ logLevel: debug
 `,
 			expectedErrContains: "no clusters in config",
 		},
+		{
+			name: "duplicate cluster names",
+			configStr: `---
+clusters:
+- name: test cluster
+- name: test cluster
+`,
+			expectedErrContains: "duplicate cluster name",
+		},
+		{
+			name: "token connection",
+			configStr: `---
+clusters:
+- name: test cluster
+  connection:
+    mode: token
+    server: https://api.example.com:8443
+    tokenFile: /var/run/secrets/archivist/token
+    caFile: /var/run/secrets/archivist/ca.crt
+`,
+			expectedConfig: ArchivistConfig{
+				Clusters: []ClusterConfig{
+					{
+						Name:                    "test cluster",
+						Schedule:                ScheduleConfig{Interval: 5 * time.Minute},
+						PodActivity:             PodActivityConfig{IgnoredOwnerKinds: []string{"Build", "Deployer"}},
+						EventActivity:           EventActivityConfig{Reasons: []string{"ScalingReplicaSet", "DeploymentCreated", "DeploymentCancelled"}},
+						RouterLog:               RouterLogConfig{IgnoredStatusCodes: []int{503}},
+						ProtectedNamespaceRules: NamespaceProtectionConfig{Patterns: []string{"openshift", "openshift-*", "kube-*"}},
+						Connection: ClusterConnection{
+							Mode:      "token",
+							Server:    "https://api.example.com:8443",
+							TokenFile: "/var/run/secrets/archivist/token",
+							CAFile:    "/var/run/secrets/archivist/ca.crt",
+						},
+						ProtectedNamespaces: []string{"default", "openshift-infra"},
+					},
+				},
+				LogLevel:                "info",
+				ListenAddress:           ":8080",
+				LivenessCheckMultiplier: 3,
+				CacheSyncTimeout:        10 * time.Minute,
+				ActivityStore: ActivityStoreConfig{
+					Path:          "/var/lib/archivist/activity.db",
+					FlushInterval: 30 * time.Second,
+				},
+				ArchiveStore: ArchiveStoreConfig{
+					Type:       "filesystem",
+					Filesystem: FilesystemStoreConfig{Path: "/var/lib/archivist/archives"},
+				},
+			},
+		},
+		{
+			name: "token connection without token file",
+			configStr: `---
+clusters:
+- name: test cluster
+  connection:
+    mode: token
+    server: https://api.example.com:8443
+`,
+			expectedErrContains: "must specify a server and tokenFile",
+		},
+		{
+			name: "in cluster connection with kubeconfig",
+			configStr: `---
+clusters:
+- name: test cluster
+  connection:
+    mode: inCluster
+    kubeconfig: /etc/archivist/kubeconfig
+`,
+			expectedErrContains: "inCluster connection cannot specify any other connection settings",
+		},
+		{
+			name: "invalid connection mode",
+			configStr: `---
+clusters:
+- name: test cluster
+  connection:
+    mode: carrier-pigeon
+`,
+			expectedErrContains: "invalid connection mode",
+		},
+		{
+			name: "cron schedule with maintenance windows",
+			configStr: `---
+clusters:
+- name: test cluster
+  schedule:
+    cron: "*/15 * * * *"
+    maintenanceWindows:
+    - days: [Mon, tuesday]
+      start: "09:00"
+      end: "17:30"
+      timezone: Europe/London
+    - start: "22:00"
+      end: "24:00"
+`,
+			expectedConfig: ArchivistConfig{
+				Clusters: []ClusterConfig{
+					{
+						Name:       "test cluster",
+						Connection: ClusterConnection{Mode: "kubeconfig"},
+						Schedule: ScheduleConfig{
+							Cron: "*/15 * * * *",
+							MaintenanceWindows: []MaintenanceWindow{
+								{Days: []string{"Mon", "tuesday"}, Start: "09:00", End: "17:30", Timezone: "Europe/London"},
+								{Start: "22:00", End: "24:00"},
+							},
+						},
+						PodActivity:             PodActivityConfig{IgnoredOwnerKinds: []string{"Build", "Deployer"}},
+						EventActivity:           EventActivityConfig{Reasons: []string{"ScalingReplicaSet", "DeploymentCreated", "DeploymentCancelled"}},
+						RouterLog:               RouterLogConfig{IgnoredStatusCodes: []int{503}},
+						ProtectedNamespaceRules: NamespaceProtectionConfig{Patterns: []string{"openshift", "openshift-*", "kube-*"}},
+						ProtectedNamespaces:     []string{"default", "openshift-infra"},
+					},
+				},
+				LogLevel:                "info",
+				ListenAddress:           ":8080",
+				LivenessCheckMultiplier: 3,
+				CacheSyncTimeout:        10 * time.Minute,
+				ActivityStore: ActivityStoreConfig{
+					Path:          "/var/lib/archivist/activity.db",
+					FlushInterval: 30 * time.Second,
+				},
+				ArchiveStore: ArchiveStoreConfig{
+					Type:       "filesystem",
+					Filesystem: FilesystemStoreConfig{Path: "/var/lib/archivist/archives"},
+				},
+			},
+		},
+		{
+			name: "schedule with interval and cron",
+			configStr: `---
+clusters:
+- name: test cluster
+  schedule:
+    interval: 10m
+    cron: "*/15 * * * *"
+`,
+			expectedErrContains: "both an interval and a cron expression",
+		},
+		{
+			name: "invalid cron expression",
+			configStr: `---
+clusters:
+- name: test cluster
+  schedule:
+    cron: "every tuesday"
+`,
+			expectedErrContains: "invalid schedule cron expression",
+		},
+		{
+			name: "invalid maintenance window day",
+			configStr: `---
+clusters:
+- name: test cluster
+  schedule:
+    maintenanceWindows:
+    - days: [Caturday]
+      start: "09:00"
+      end: "17:00"
+`,
+			expectedErrContains: "invalid day of the week",
+		},
+		{
+			name: "invalid maintenance window time",
+			configStr: `---
+clusters:
+- name: test cluster
+  schedule:
+    maintenanceWindows:
+    - start: "9am"
+      end: "17:00"
+`,
+			expectedErrContains: "invalid time of day",
+		},
+		{
+			name: "maintenance window ends before it starts",
+			configStr: `---
+clusters:
+- name: test cluster
+  schedule:
+    maintenanceWindows:
+    - start: "17:00"
+      end: "09:00"
+`,
+			expectedErrContains: "must be after start",
+		},
+		{
+			name: "invalid maintenance window timezone",
+			configStr: `---
+clusters:
+- name: test cluster
+  schedule:
+    maintenanceWindows:
+    - start: "09:00"
+      end: "17:00"
+      timezone: Mars/Olympus_Mons
+`,
+			expectedErrContains: "invalid maintenance window timezone",
+		},
+		{
+			name: "negative activity source weight",
+			configStr: `---
+clusters:
+- name: test cluster
+  activitySources:
+    builds:
+      weight: -1
+`,
+			expectedErrContains: "weight cannot be negative",
+		},
+		{
+			name: "no ignored pod owner kinds",
+			configStr: `---
+clusters:
+- name: test cluster
+  podActivity:
+    ignoredOwnerKinds: []
+`,
+			expectedConfig: ArchivistConfig{
+				Clusters: []ClusterConfig{
+					{
+						Name:        "test cluster",
+						Connection:  ClusterConnection{Mode: "kubeconfig"},
+						Schedule:    ScheduleConfig{Interval: 5 * time.Minute},
+						PodActivity: PodActivityConfig{IgnoredOwnerKinds: []string{}},
+						EventActivity: EventActivityConfig{Reasons: []string{"ScalingReplicaSet", "DeploymentCreated",
+							"DeploymentCancelled"}},
+						RouterLog:               RouterLogConfig{IgnoredStatusCodes: []int{503}},
+						ProtectedNamespaces:     []string{"default", "openshift-infra"},
+						ProtectedNamespaceRules: NamespaceProtectionConfig{Patterns: []string{"openshift", "openshift-*", "kube-*"}},
+					},
+				},
+				LogLevel:                "info",
+				ListenAddress:           ":8080",
+				LivenessCheckMultiplier: 3,
+				CacheSyncTimeout:        10 * time.Minute,
+				ActivityStore: ActivityStoreConfig{
+					Path:          "/var/lib/archivist/activity.db",
+					FlushInterval: 30 * time.Second,
+				},
+				ArchiveStore: ArchiveStoreConfig{
+					Type:       "filesystem",
+					Filesystem: FilesystemStoreConfig{Path: "/var/lib/archivist/archives"},
+				},
+			},
+		},
+		{
+			name: "any event reason except ignored",
+			configStr: `---
+clusters:
+- name: test cluster
+  eventActivity:
+    reasons: []
+    ignoredReasons:
+    - BackOff
+`,
+			expectedConfig: ArchivistConfig{
+				Clusters: []ClusterConfig{
+					{
+						Name:                    "test cluster",
+						Connection:              ClusterConnection{Mode: "kubeconfig"},
+						Schedule:                ScheduleConfig{Interval: 5 * time.Minute},
+						PodActivity:             PodActivityConfig{IgnoredOwnerKinds: []string{"Build", "Deployer"}},
+						EventActivity:           EventActivityConfig{Reasons: []string{}, IgnoredReasons: []string{"BackOff"}},
+						RouterLog:               RouterLogConfig{IgnoredStatusCodes: []int{503}},
+						ProtectedNamespaces:     []string{"default", "openshift-infra"},
+						ProtectedNamespaceRules: NamespaceProtectionConfig{Patterns: []string{"openshift", "openshift-*", "kube-*"}},
+					},
+				},
+				LogLevel:                "info",
+				ListenAddress:           ":8080",
+				LivenessCheckMultiplier: 3,
+				CacheSyncTimeout:        10 * time.Minute,
+				ActivityStore: ActivityStoreConfig{
+					Path:          "/var/lib/archivist/activity.db",
+					FlushInterval: 30 * time.Second,
+				},
+				ArchiveStore: ArchiveStoreConfig{
+					Type:       "filesystem",
+					Filesystem: FilesystemStoreConfig{Path: "/var/lib/archivist/archives"},
+				},
+			},
+		},
+		{
+			name: "event reason counted and ignored",
+			configStr: `---
+clusters:
+- name: test cluster
+  eventActivity:
+    reasons:
+    - Pulling
+    ignoredReasons:
+    - Pulling
+`,
+			expectedErrContains: "event reason Pulling cannot be both counted and ignored",
+		},
+		{
+			name: "router log file and syslog",
+			configStr: `---
+clusters:
+- name: test cluster
+  routerLog:
+    path: /var/log/haproxy.log
+    syslogAddress: ":5140"
+`,
+			expectedErrContains: "routerLog cannot set both path and syslogAddress",
+		},
+		{
+			name: "invalid router log timezone",
+			configStr: `---
+clusters:
+- name: test cluster
+  routerLog:
+    path: /var/log/haproxy.log
+    timezone: Mars/Olympus_Mons
+`,
+			expectedErrContains: "invalid routerLog timezone",
+		},
+		{
+			name: "protected namespace rules",
+			configStr: `---
+clusters:
+- name: test cluster
+  protectedNamespaceRules:
+    patterns: []
+    regexps:
+    - ^ops-[0-9]+$
+    labelSelectors:
+    - archivist.openshift.io/protected
+    annotations:
+    - openshift.io/requester=system:admin
+`,
+			expectedConfig: ArchivistConfig{
+				Clusters: []ClusterConfig{
+					{
+						Name:        "test cluster",
+						Connection:  ClusterConnection{Mode: "kubeconfig"},
+						Schedule:    ScheduleConfig{Interval: 5 * time.Minute},
+						PodActivity: PodActivityConfig{IgnoredOwnerKinds: []string{"Build", "Deployer"}},
+						EventActivity: EventActivityConfig{Reasons: []string{"ScalingReplicaSet", "DeploymentCreated",
+							"DeploymentCancelled"}},
+						RouterLog:           RouterLogConfig{IgnoredStatusCodes: []int{503}},
+						ProtectedNamespaces: []string{"default", "openshift-infra"},
+						ProtectedNamespaceRules: NamespaceProtectionConfig{
+							Patterns:       []string{},
+							Regexps:        []string{"^ops-[0-9]+$"},
+							LabelSelectors: []string{"archivist.openshift.io/protected"},
+							Annotations:    []string{"openshift.io/requester=system:admin"},
+						},
+					},
+				},
+				LogLevel:                "info",
+				ListenAddress:           ":8080",
+				LivenessCheckMultiplier: 3,
+				CacheSyncTimeout:        10 * time.Minute,
+				ActivityStore: ActivityStoreConfig{
+					Path:          "/var/lib/archivist/activity.db",
+					FlushInterval: 30 * time.Second,
+				},
+				ArchiveStore: ArchiveStoreConfig{
+					Type:       "filesystem",
+					Filesystem: FilesystemStoreConfig{Path: "/var/lib/archivist/archives"},
+				},
+			},
+		},
+		{
+			name: "invalid protected namespace pattern",
+			configStr: `---
+clusters:
+- name: test cluster
+  protectedNamespaceRules:
+    patterns:
+    - "openshift-["
+`,
+			expectedErrContains: "invalid protected namespace pattern",
+		},
+		{
+			name: "invalid protected namespace regexp",
+			configStr: `---
+clusters:
+- name: test cluster
+  protectedNamespaceRules:
+    regexps:
+    - "kube-(.*"
+`,
+			expectedErrContains: "invalid protected namespace regexp",
+		},
+		{
+			name: "negative max empty days",
+			configStr: `---
+clusters:
+- name: test cluster
+  emptyNamespaces:
+    maxEmptyDays: -1
+`,
+			expectedErrContains: "emptyNamespaces maxEmptyDays cannot be negative",
+		},
+		{
+			name: "negative max exempt days",
+			configStr: `---
+clusters:
+- name: test cluster
+  namespaceAnnotations:
+    maxExemptDays: -1
+`,
+			expectedErrContains: "namespaceAnnotations maxExemptDays cannot be negative",
+		},
 		{
 			name: "cluster must have a name",
 			configStr: `---
@@ -0,0 +1,88 @@
+package leaderelection
+
+import (
+	"encoding/json"
+	"fmt"
+
+	kapi "k8s.io/kubernetes/pkg/api"
+	kerrors "k8s.io/kubernetes/pkg/api/errors"
+	kclientset "k8s.io/kubernetes/pkg/client/clientset_generated/internalclientset"
+)
+
+// LeaderAnnotation is the annotation on the lock ConfigMap holding the JSON encoded LeaderElectionRecord.
+const LeaderAnnotation = "archivist.openshift.io/leader"
+
+// ConfigMapLock stores the leader election record in an annotation on a ConfigMap. The ConfigMap resource
+// version provides the optimistic concurrency Lock requires.
+type ConfigMapLock struct {
+	kc        kclientset.Interface
+	namespace string
+	name      string
+}
+
+func NewConfigMapLock(kc kclientset.Interface, namespace, name string) *ConfigMapLock {
+	return &ConfigMapLock{kc: kc, namespace: namespace, name: name}
+}
+
+func (l *ConfigMapLock) Get() (*LeaderElectionRecord, string, error) {
+	cm, err := l.kc.Core().ConfigMaps(l.namespace).Get(l.name)
+	if kerrors.IsNotFound(err) {
+		return nil, "", nil
+	}
+	if err != nil {
+		return nil, "", err
+	}
+	record := &LeaderElectionRecord{}
+	if data, ok := cm.Annotations[LeaderAnnotation]; ok {
+		if err := json.Unmarshal([]byte(data), record); err != nil {
+			return nil, "", fmt.Errorf("invalid leader election record: %s", err)
+		}
+	}
+	return record, cm.ResourceVersion, nil
+}
+
+func (l *ConfigMapLock) Create(record LeaderElectionRecord) error {
+	data, err := json.Marshal(record)
+	if err != nil {
+		return err
+	}
+	_, err = l.kc.Core().ConfigMaps(l.namespace).Create(&kapi.ConfigMap{
+		ObjectMeta: kapi.ObjectMeta{
+			Name:        l.name,
+			Namespace:   l.namespace,
+			Annotations: map[string]string{LeaderAnnotation: string(data)},
+		},
+	})
+	if kerrors.IsAlreadyExists(err) {
+		return ErrConflict
+	}
+	return err
+}
+
+func (l *ConfigMapLock) Update(record LeaderElectionRecord, version string) error {
+	cm, err := l.kc.Core().ConfigMaps(l.namespace).Get(l.name)
+	if err != nil {
+		return err
+	}
+	if cm.ResourceVersion != version {
+		return ErrConflict
+	}
+	data, err := json.Marshal(record)
+	if err != nil {
+		return err
+	}
+	if cm.Annotations == nil {
+		cm.Annotations = map[string]string{}
+	}
+	cm.Annotations[LeaderAnnotation] = string(data)
+	// The server rejects the update if the resource version has changed since our Get:
+	_, err = l.kc.Core().ConfigMaps(l.namespace).Update(cm)
+	if kerrors.IsConflict(err) {
+		return ErrConflict
+	}
+	return err
+}
+
+func (l *ConfigMapLock) Describe() string {
+	return fmt.Sprintf("configmap/%s/%s", l.namespace, l.name)
+}
@@ -0,0 +1,219 @@
+// Package leaderelection ensures only one of several archivist replicas acts on a cluster at a time.
+//
+// Replicas compete for a lease recorded in a lock object in the cluster. The leader renews the lease every
+// retry period; if it cannot renew within the renew deadline it stops acting as leader. Other replicas only
+// take over once the lease has not been renewed for the full lease duration, which must be longer than the
+// renew deadline so a leader always stops before another replica can start.
+package leaderelection
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	log "github.com/Sirupsen/logrus"
+)
+
+const logComponent = "leaderelection"
+
+// ErrConflict is returned by a Lock when the record was modified since it was read.
+var ErrConflict = errors.New("leader election record was modified concurrently")
+
+// LeaderElectionRecord is the state of the lease stored in the lock.
+type LeaderElectionRecord struct {
+	HolderIdentity       string    `json:"holderIdentity"`
+	LeaseDurationSeconds int       `json:"leaseDurationSeconds"`
+	AcquireTime          time.Time `json:"acquireTime"`
+	RenewTime            time.Time `json:"renewTime"`
+	LeaderTransitions    int       `json:"leaderTransitions"`
+}
+
+// Lock stores the leader election record. Updates must fail with ErrConflict if the record has been changed
+// since the given version was read.
+type Lock interface {
+	// Get returns the current record and its version, or a nil record if the lock does not exist.
+	Get() (*LeaderElectionRecord, string, error)
+	// Create creates the lock with the given record.
+	Create(record LeaderElectionRecord) error
+	// Update replaces the record if it is still at the given version.
+	Update(record LeaderElectionRecord, version string) error
+	// Describe returns a description of the lock for logging.
+	Describe() string
+}
+
+// LeaderElector runs the election for a single replica.
+type LeaderElector struct {
+	lock          Lock
+	identity      string
+	leaseDuration time.Duration
+	renewDeadline time.Duration
+	retryPeriod   time.Duration
+
+	// The last record seen, and when it was first seen. Expiry of another replica's lease is judged by our
+	// own clock from the time we observed the record, so clock skew between replicas does not matter.
+	observedRecord LeaderElectionRecord
+	observedTime   time.Time
+
+	now func() time.Time
+	log *log.Entry
+}
+
+func NewLeaderElector(lock Lock, identity string, leaseDuration, renewDeadline, retryPeriod time.Duration) (*LeaderElector, error) {
+	if identity == "" {
+		return nil, fmt.Errorf("leader election identity must not be empty")
+	}
+	if renewDeadline >= leaseDuration {
+		return nil, fmt.Errorf("leader election lease duration must be greater than the renew deadline")
+	}
+	if retryPeriod >= renewDeadline {
+		return nil, fmt.Errorf("leader election renew deadline must be greater than the retry period")
+	}
+	return &LeaderElector{
+		lock:          lock,
+		identity:      identity,
+		leaseDuration: leaseDuration,
+		renewDeadline: renewDeadline,
+		retryPeriod:   retryPeriod,
+		now:           time.Now,
+		log: log.WithFields(log.Fields{
+			"component": logComponent,
+			"lock":      lock.Describe(),
+			"identity":  identity,
+		}),
+	}, nil
+}
+
+// Run competes for leadership until stopChan is closed. Each time leadership is acquired onStartedLeading is
+// called with a channel which is closed when leadership is lost, or on shutdown. onStartedLeading must not
+// block. When stopChan is closed the lease is released so another replica can take over promptly.
+func (le *LeaderElector) Run(stopChan <-chan struct{}, onStartedLeading func(leaderStop <-chan struct{})) {
+	for {
+		if !le.acquire(stopChan) {
+			return
+		}
+		le.log.Infoln("acquired leadership")
+		leaderStop := make(chan struct{})
+		onStartedLeading(leaderStop)
+		le.renew(stopChan)
+		close(leaderStop)
+
+		select {
+		case <-stopChan:
+			le.release()
+			return
+		default:
+		}
+		le.log.Warnln("lost leadership")
+	}
+}
+
+// acquire blocks until leadership is acquired, returning false if stopChan is closed first.
+func (le *LeaderElector) acquire(stopChan <-chan struct{}) bool {
+	for {
+		acquired, err := le.tryAcquireOrRenew()
+		if err != nil {
+			le.log.Errorf("error acquiring leadership: %s", err)
+		}
+		if acquired {
+			return true
+		}
+		select {
+		case <-stopChan:
+			return false
+		case <-time.After(le.retryPeriod):
+		}
+	}
+}
+
+// renew blocks renewing the lease until it cannot be renewed within the renew deadline, or stopChan is closed.
+func (le *LeaderElector) renew(stopChan <-chan struct{}) {
+	deadline := le.now().Add(le.renewDeadline)
+	for {
+		select {
+		case <-stopChan:
+			return
+		case <-time.After(le.retryPeriod):
+		}
+		renewed, err := le.tryAcquireOrRenew()
+		if err != nil {
+			le.log.Errorf("error renewing leadership: %s", err)
+		}
+		if renewed {
+			deadline = le.now().Add(le.renewDeadline)
+		} else if le.now().After(deadline) {
+			return
+		}
+	}
+}
+
+// tryAcquireOrRenew makes a single attempt to acquire or renew the lease, returning true if we hold it.
+func (le *LeaderElector) tryAcquireOrRenew() (bool, error) {
+	// UTC so records compare equal to their JSON decoded form:
+	now := le.now().UTC()
+	record := LeaderElectionRecord{
+		HolderIdentity:       le.identity,
+		LeaseDurationSeconds: int(le.leaseDuration / time.Second),
+		AcquireTime:          now,
+		RenewTime:            now,
+	}
+
+	oldRecord, version, err := le.lock.Get()
+	if err != nil {
+		return false, err
+	}
+	if oldRecord == nil {
+		if err := le.lock.Create(record); err != nil {
+			if err == ErrConflict {
+				// Another replica created the lock first:
+				return false, nil
+			}
+			return false, err
+		}
+		le.observe(record, now)
+		return true, nil
+	}
+
+	if *oldRecord != le.observedRecord {
+		le.observe(*oldRecord, now)
+	}
+	heldByOther := oldRecord.HolderIdentity != "" && oldRecord.HolderIdentity != le.identity
+	if heldByOther && le.observedTime.Add(le.leaseDuration).After(now) {
+		return false, nil
+	}
+
+	if oldRecord.HolderIdentity == le.identity {
+		record.AcquireTime = oldRecord.AcquireTime
+		record.LeaderTransitions = oldRecord.LeaderTransitions
+	} else {
+		record.LeaderTransitions = oldRecord.LeaderTransitions + 1
+	}
+	if err := le.lock.Update(record, version); err != nil {
+		if err == ErrConflict {
+			// Another replica got there first:
+			return false, nil
+		}
+		return false, err
+	}
+	le.observe(record, now)
+	return true, nil
+}
+
+// release gives up the lease if we still hold it.
+func (le *LeaderElector) release() {
+	record, version, err := le.lock.Get()
+	if err != nil || record == nil || record.HolderIdentity != le.identity {
+		return
+	}
+	released := *record
+	released.HolderIdentity = ""
+	if err := le.lock.Update(released, version); err != nil {
+		le.log.Warnf("error releasing leadership: %s", err)
+		return
+	}
+	le.log.Infoln("released leadership")
+}
+
+func (le *LeaderElector) observe(record LeaderElectionRecord, now time.Time) {
+	le.observedRecord = record
+	le.observedTime = now
+}
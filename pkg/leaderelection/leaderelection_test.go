@@ -0,0 +1,214 @@
+package leaderelection
+
+import (
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// memoryLock is an in-memory Lock shared between electors in tests.
+type memoryLock struct {
+	sync.Mutex
+	record  *LeaderElectionRecord
+	version int
+}
+
+func (l *memoryLock) Get() (*LeaderElectionRecord, string, error) {
+	l.Lock()
+	defer l.Unlock()
+	if l.record == nil {
+		return nil, "", nil
+	}
+	record := *l.record
+	return &record, strconv.Itoa(l.version), nil
+}
+
+func (l *memoryLock) Create(record LeaderElectionRecord) error {
+	l.Lock()
+	defer l.Unlock()
+	if l.record != nil {
+		return ErrConflict
+	}
+	l.record = &record
+	l.version++
+	return nil
+}
+
+func (l *memoryLock) Update(record LeaderElectionRecord, version string) error {
+	l.Lock()
+	defer l.Unlock()
+	if strconv.Itoa(l.version) != version {
+		return ErrConflict
+	}
+	l.record = &record
+	l.version++
+	return nil
+}
+
+func (l *memoryLock) Describe() string {
+	return "memory"
+}
+
+func (l *memoryLock) holder() string {
+	l.Lock()
+	defer l.Unlock()
+	if l.record == nil {
+		return ""
+	}
+	return l.record.HolderIdentity
+}
+
+type fakeClock struct {
+	t time.Time
+}
+
+func (c *fakeClock) now() time.Time {
+	return c.t
+}
+
+func newTestElector(t *testing.T, lock Lock, identity string, clock *fakeClock) *LeaderElector {
+	le, err := NewLeaderElector(lock, identity, 15*time.Second, 10*time.Second, 2*time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	le.now = clock.now
+	return le
+}
+
+func TestTryAcquireOrRenew(t *testing.T) {
+	lock := &memoryLock{}
+	clock := &fakeClock{time.Date(2017, time.June, 1, 12, 0, 0, 0, time.UTC)}
+	a := newTestElector(t, lock, "replica-a", clock)
+	b := newTestElector(t, lock, "replica-b", clock)
+
+	acquired, err := a.tryAcquireOrRenew()
+	assert.Nil(t, err)
+	assert.True(t, acquired)
+
+	// b must wait for the lease to expire:
+	acquired, err = b.tryAcquireOrRenew()
+	assert.Nil(t, err)
+	assert.False(t, acquired)
+
+	// a renews its lease, which b notices:
+	clock.t = clock.t.Add(10 * time.Second)
+	acquired, _ = a.tryAcquireOrRenew()
+	assert.True(t, acquired)
+	clock.t = clock.t.Add(10 * time.Second)
+	acquired, _ = b.tryAcquireOrRenew()
+	assert.False(t, acquired, "lease was renewed, b should not acquire")
+
+	// a stops renewing, once the lease duration has passed since b observed the renewal, b takes over:
+	clock.t = clock.t.Add(16 * time.Second)
+	acquired, _ = b.tryAcquireOrRenew()
+	assert.True(t, acquired)
+	assert.Equal(t, "replica-b", lock.holder())
+	assert.Equal(t, 1, lock.record.LeaderTransitions)
+
+	acquired, _ = a.tryAcquireOrRenew()
+	assert.False(t, acquired)
+}
+
+func TestTryAcquireOrRenewConflict(t *testing.T) {
+	lock := &memoryLock{}
+	clock := &fakeClock{time.Date(2017, time.June, 1, 12, 0, 0, 0, time.UTC)}
+	a := newTestElector(t, lock, "replica-a", clock)
+	acquired, _ := a.tryAcquireOrRenew()
+	assert.True(t, acquired)
+
+	// Simulate another replica updating the record between our get and update:
+	conflicting := &conflictingLock{memoryLock: lock}
+	a.lock = conflicting
+	acquired, err := a.tryAcquireOrRenew()
+	assert.Nil(t, err)
+	assert.False(t, acquired)
+}
+
+type conflictingLock struct {
+	*memoryLock
+}
+
+func (l *conflictingLock) Update(record LeaderElectionRecord, version string) error {
+	return ErrConflict
+}
+
+func TestTryAcquireOrRenewCreateConflict(t *testing.T) {
+	lock := &memoryLock{}
+	clock := &fakeClock{time.Date(2017, time.June, 1, 12, 0, 0, 0, time.UTC)}
+	a := newTestElector(t, lock, "replica-a", clock)
+	b := newTestElector(t, &unlockedLock{memoryLock: lock}, "replica-b", clock)
+
+	// Both replicas find no lock, and replica-a creates it first:
+	acquired, _ := a.tryAcquireOrRenew()
+	assert.True(t, acquired)
+	acquired, err := b.tryAcquireOrRenew()
+	assert.Nil(t, err)
+	assert.False(t, acquired)
+	assert.Equal(t, "replica-a", lock.holder())
+}
+
+// unlockedLock finds no lock, as if it had been read before another replica created it.
+type unlockedLock struct {
+	*memoryLock
+}
+
+func (l *unlockedLock) Get() (*LeaderElectionRecord, string, error) {
+	return nil, "", nil
+}
+
+func TestNewLeaderElectorValidation(t *testing.T) {
+	lock := &memoryLock{}
+	_, err := NewLeaderElector(lock, "", 15*time.Second, 10*time.Second, 2*time.Second)
+	assert.NotNil(t, err)
+	_, err = NewLeaderElector(lock, "replica-a", 10*time.Second, 10*time.Second, 2*time.Second)
+	assert.NotNil(t, err)
+	_, err = NewLeaderElector(lock, "replica-a", 15*time.Second, 10*time.Second, 10*time.Second)
+	assert.NotNil(t, err)
+}
+
+func TestRunFailover(t *testing.T) {
+	lock := &memoryLock{}
+	var mu sync.Mutex
+	started := map[string]int{}
+
+	newElector := func(identity string) *LeaderElector {
+		le, err := NewLeaderElector(lock, identity, 150*time.Millisecond, 100*time.Millisecond, 20*time.Millisecond)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return le
+	}
+	run := func(le *LeaderElector, stopChan <-chan struct{}, done chan<- struct{}) {
+		le.Run(stopChan, func(leaderStop <-chan struct{}) {
+			mu.Lock()
+			started[le.identity]++
+			mu.Unlock()
+		})
+		close(done)
+	}
+
+	stopA, doneA := make(chan struct{}), make(chan struct{})
+	stopB, doneB := make(chan struct{}), make(chan struct{})
+	go run(newElector("replica-a"), stopA, doneA)
+	time.Sleep(50 * time.Millisecond)
+	go run(newElector("replica-b"), stopB, doneB)
+	time.Sleep(200 * time.Millisecond)
+	assert.Equal(t, "replica-a", lock.holder())
+
+	// Stopping the leader releases the lease, the other replica should take over without waiting for it
+	// to expire:
+	close(stopA)
+	<-doneA
+	time.Sleep(100 * time.Millisecond)
+	assert.Equal(t, "replica-b", lock.holder())
+
+	close(stopB)
+	<-doneB
+	assert.Equal(t, "", lock.holder())
+	mu.Lock()
+	assert.Equal(t, map[string]int{"replica-a": 1, "replica-b": 1}, started)
+	mu.Unlock()
+}
@@ -0,0 +1,134 @@
+// Package metrics defines the Prometheus metrics exported by the archivist. Every metric is labelled with the
+// name of the cluster it relates to.
+//
+// Restores are not counted, as they are run from the command line by a process which serves no metrics.
+package metrics
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+const metricsNamespace = "archivist"
+
+const (
+	resultSuccess = "success"
+	resultFailure = "failure"
+)
+
+var (
+	// Namespaces is the number of namespaces seen by the last capacity check.
+	Namespaces = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: metricsNamespace,
+		Name:      "namespaces",
+		Help:      "Number of namespaces in the cluster at the last capacity check.",
+	}, []string{"cluster"})
+
+	// VeryInactiveNamespaces is the number of namespaces inactive for longer than maxInactiveDays.
+	VeryInactiveNamespaces = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: metricsNamespace,
+		Name:      "very_inactive_namespaces",
+		Help:      "Number of namespaces inactive for longer than maxInactiveDays at the last capacity check.",
+	}, []string{"cluster"})
+
+	// SomewhatInactiveNamespaces is the number of namespaces inactive for between minInactiveDays and
+	// maxInactiveDays.
+	SomewhatInactiveNamespaces = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: metricsNamespace,
+		Name:      "somewhat_inactive_namespaces",
+		Help:      "Number of namespaces inactive for between minInactiveDays and maxInactiveDays at the last capacity check.",
+	}, []string{"cluster"})
+
+	// SelectedNamespaces is the number of namespaces selected for archival by the last capacity check.
+	SelectedNamespaces = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: metricsNamespace,
+		Name:      "selected_namespaces",
+		Help:      "Number of namespaces selected for archival by the last capacity check.",
+	}, []string{"cluster"})
+
+	// LowWatermarkReachable is 1 if archiving the selected namespaces brings the cluster down to the low
+	// watermark, 0 if not.
+	LowWatermarkReachable = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: metricsNamespace,
+		Name:      "low_watermark_reachable",
+		Help:      "Whether the last capacity check could select enough namespaces to reach the low watermark.",
+	}, []string{"cluster"})
+
+	// CapacityCheckDuration is the time taken by each capacity check, including archival.
+	CapacityCheckDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: metricsNamespace,
+		Name:      "capacity_check_duration_seconds",
+		Help:      "Time taken to check capacity and archive the selected namespaces.",
+		Buckets:   prometheus.ExponentialBuckets(0.1, 4, 8),
+	}, []string{"cluster"})
+
+	// InformerSynced is 1 once an informer has completed its initial list, 0 until then.
+	InformerSynced = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: metricsNamespace,
+		Name:      "informer_synced",
+		Help:      "Whether each informer has completed its initial list of API objects.",
+	}, []string{"cluster", "informer"})
+
+	// Archives counts namespace archivals by result.
+	Archives = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: metricsNamespace,
+		Name:      "archives_total",
+		Help:      "Number of namespaces archived, by result.",
+	}, []string{"cluster", "result"})
+
+	// ArchivesRefused counts namespaces not archived because they contain an object archives cannot hold, by the
+	// kind of the object.
+	ArchivesRefused = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: metricsNamespace,
+		Name:      "archives_refused_total",
+		Help:      "Number of namespaces not archived because they contain objects which cannot be archived, by kind.",
+	}, []string{"cluster", "kind"})
+)
+
+func init() {
+	prometheus.MustRegister(
+		Namespaces,
+		VeryInactiveNamespaces,
+		SomewhatInactiveNamespaces,
+		SelectedNamespaces,
+		LowWatermarkReachable,
+		CapacityCheckDuration,
+		InformerSynced,
+		Archives,
+		ArchivesRefused,
+	)
+}
+
+// RecordArchive counts an archival of a namespace in the cluster, which failed if err is not nil.
+func RecordArchive(cluster string, err error) {
+	Archives.WithLabelValues(cluster, result(err)).Inc()
+}
+
+// RecordArchiveRefused counts a namespace in the cluster which was not archived because of an object of the given
+// kind.
+func RecordArchiveRefused(cluster, kind string) {
+	ArchivesRefused.WithLabelValues(cluster, kind).Inc()
+}
+
+// SetInformerSynced records whether the named informer for the cluster has synced.
+func SetInformerSynced(cluster, informer string, synced bool) {
+	InformerSynced.WithLabelValues(cluster, informer).Set(boolValue(synced))
+}
+
+// SetLowWatermarkReachable records whether the last capacity check could reach the low watermark.
+func SetLowWatermarkReachable(cluster string, reachable bool) {
+	LowWatermarkReachable.WithLabelValues(cluster).Set(boolValue(reachable))
+}
+
+func result(err error) string {
+	if err != nil {
+		return resultFailure
+	}
+	return resultSuccess
+}
+
+func boolValue(b bool) float64 {
+	if b {
+		return 1
+	}
+	return 0
+}
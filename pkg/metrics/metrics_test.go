@@ -0,0 +1,50 @@
+package metrics
+
+import (
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/stretchr/testify/assert"
+)
+
+// scrape returns the text exposition of every registered metric.
+func scrape(t *testing.T) string {
+	server := httptest.NewServer(prometheus.Handler())
+	defer server.Close()
+	resp, err := http.Get(server.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(body)
+}
+
+func TestRecordResults(t *testing.T) {
+	RecordArchive("cluster1", nil)
+	RecordArchive("cluster1", nil)
+	RecordArchive("cluster1", errors.New("failed"))
+	RecordArchiveRefused("cluster1", "StatefulSet")
+	SetInformerSynced("cluster1", "builds", true)
+	SetInformerSynced("cluster1", "namespaces", false)
+	SetLowWatermarkReachable("cluster1", true)
+
+	body := scrape(t)
+	for _, expected := range []string{
+		`archivist_archives_total{cluster="cluster1",result="success"} 2`,
+		`archivist_archives_total{cluster="cluster1",result="failure"} 1`,
+		`archivist_archives_refused_total{cluster="cluster1",kind="StatefulSet"} 1`,
+		`archivist_informer_synced{cluster="cluster1",informer="builds"} 1`,
+		`archivist_informer_synced{cluster="cluster1",informer="namespaces"} 0`,
+		`archivist_low_watermark_reachable{cluster="cluster1"} 1`,
+	} {
+		assert.Contains(t, body, expected)
+	}
+}
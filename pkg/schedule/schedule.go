@@ -0,0 +1,98 @@
+// Package schedule determines when capacity checks run for a cluster, and when namespaces may be archived.
+package schedule
+
+import (
+	"time"
+
+	"github.com/openshift/online/archivist/pkg/config"
+
+	"github.com/robfig/cron"
+)
+
+// Schedule runs capacity checks either at a fixed interval or as given by a cron expression.
+type Schedule struct {
+	interval time.Duration
+	cron     cron.Schedule
+	windows  []window
+}
+
+// window is a parsed config.MaintenanceWindow.
+type window struct {
+	// days the window applies to, every day if empty:
+	days map[time.Weekday]bool
+	// start and end are offsets from midnight:
+	start    time.Duration
+	end      time.Duration
+	location *time.Location
+}
+
+// New returns the schedule for a validated schedule configuration.
+func New(cfg config.ScheduleConfig) (*Schedule, error) {
+	s := &Schedule{interval: cfg.Interval}
+	if cfg.Cron != "" {
+		cs, err := cron.ParseStandard(cfg.Cron)
+		if err != nil {
+			return nil, err
+		}
+		s.cron = cs
+	}
+	for _, mw := range cfg.MaintenanceWindows {
+		w := window{days: map[time.Weekday]bool{}}
+		for _, d := range mw.Days {
+			day, err := config.ParseWeekday(d)
+			if err != nil {
+				return nil, err
+			}
+			w.days[day] = true
+		}
+		var err error
+		if w.start, err = config.ParseTimeOfDay(mw.Start); err != nil {
+			return nil, err
+		}
+		if w.end, err = config.ParseTimeOfDay(mw.End); err != nil {
+			return nil, err
+		}
+		if w.location, err = time.LoadLocation(mw.Timezone); err != nil {
+			return nil, err
+		}
+		s.windows = append(s.windows, w)
+	}
+	return s, nil
+}
+
+// First returns the time of the first capacity check for a monitor started at the given time. Interval schedules
+// check immediately, rather than waiting a complete interval.
+func (s *Schedule) First(start time.Time) time.Time {
+	if s.cron != nil {
+		return s.cron.Next(start.UTC())
+	}
+	return start
+}
+
+// Next returns the time of the capacity check following one at the given time.
+func (s *Schedule) Next(t time.Time) time.Time {
+	if s.cron != nil {
+		return s.cron.Next(t.UTC())
+	}
+	return t.Add(s.interval)
+}
+
+// InMaintenanceWindow returns true if namespaces may be archived at the given time.
+func (s *Schedule) InMaintenanceWindow(t time.Time) bool {
+	if len(s.windows) == 0 {
+		return true
+	}
+	for _, w := range s.windows {
+		local := t.In(w.location)
+		if len(w.days) > 0 && !w.days[local.Weekday()] {
+			continue
+		}
+		// Wall clock time, so windows are unaffected by daylight saving transitions:
+		offset := time.Duration(local.Hour())*time.Hour + time.Duration(local.Minute())*time.Minute +
+			time.Duration(local.Second())*time.Second
+		if offset >= w.start && offset < w.end {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,123 @@
+package schedule
+
+import (
+	"testing"
+	"time"
+
+	"github.com/openshift/online/archivist/pkg/config"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestIntervalSchedule(t *testing.T) {
+	s, err := New(config.ScheduleConfig{Interval: 10 * time.Minute})
+	if !assert.Nil(t, err) {
+		return
+	}
+	start := time.Date(2017, time.May, 29, 12, 3, 0, 0, time.UTC)
+	assert.Equal(t, start, s.First(start))
+	assert.Equal(t, start.Add(10*time.Minute), s.Next(start))
+}
+
+func TestCronSchedule(t *testing.T) {
+	s, err := New(config.ScheduleConfig{Cron: "*/15 * * * *"})
+	if !assert.Nil(t, err) {
+		return
+	}
+	start := time.Date(2017, time.May, 29, 12, 3, 0, 0, time.UTC)
+	assert.Equal(t, time.Date(2017, time.May, 29, 12, 15, 0, 0, time.UTC), s.First(start))
+	assert.Equal(t, time.Date(2017, time.May, 29, 12, 30, 0, 0, time.UTC), s.Next(s.First(start)))
+}
+
+func TestInMaintenanceWindow(t *testing.T) {
+	london, err := time.LoadLocation("Europe/London")
+	if !assert.Nil(t, err) {
+		return
+	}
+	tests := []struct {
+		name     string
+		windows  []config.MaintenanceWindow
+		time     time.Time
+		expected bool
+	}{
+		{
+			name:     "no windows",
+			time:     time.Date(2017, time.May, 28, 3, 0, 0, 0, time.UTC),
+			expected: true,
+		},
+		{
+			name: "within window",
+			windows: []config.MaintenanceWindow{
+				{Days: []string{"Mon", "Tue"}, Start: "09:00", End: "17:00"},
+			},
+			time:     time.Date(2017, time.May, 29, 9, 0, 0, 0, time.UTC), // Monday
+			expected: true,
+		},
+		{
+			name: "window end is exclusive",
+			windows: []config.MaintenanceWindow{
+				{Days: []string{"Mon", "Tue"}, Start: "09:00", End: "17:00"},
+			},
+			time:     time.Date(2017, time.May, 29, 17, 0, 0, 0, time.UTC),
+			expected: false,
+		},
+		{
+			name: "wrong day",
+			windows: []config.MaintenanceWindow{
+				{Days: []string{"Mon", "Tue"}, Start: "09:00", End: "17:00"},
+			},
+			time:     time.Date(2017, time.May, 31, 12, 0, 0, 0, time.UTC), // Wednesday
+			expected: false,
+		},
+		{
+			name: "every day",
+			windows: []config.MaintenanceWindow{
+				{Start: "22:00", End: "24:00"},
+			},
+			time:     time.Date(2017, time.May, 31, 23, 59, 0, 0, time.UTC),
+			expected: true,
+		},
+		{
+			name: "second window",
+			windows: []config.MaintenanceWindow{
+				{Days: []string{"Mon"}, Start: "09:00", End: "10:00"},
+				{Days: []string{"Wednesday"}, Start: "09:00", End: "10:00"},
+			},
+			time:     time.Date(2017, time.May, 31, 9, 30, 0, 0, time.UTC),
+			expected: true,
+		},
+		{
+			name: "timezone",
+			windows: []config.MaintenanceWindow{
+				// 09:00 BST is 08:00 UTC:
+				{Days: []string{"Mon"}, Start: "09:00", End: "17:00", Timezone: "Europe/London"},
+			},
+			time:     time.Date(2017, time.May, 29, 8, 30, 0, 0, time.UTC),
+			expected: true,
+		},
+		{
+			name: "timezone outside window",
+			windows: []config.MaintenanceWindow{
+				{Days: []string{"Mon"}, Start: "09:00", End: "17:00", Timezone: "Europe/London"},
+			},
+			time:     time.Date(2017, time.May, 29, 16, 30, 0, 0, time.UTC),
+			expected: false,
+		},
+		{
+			name: "timezone changes day",
+			windows: []config.MaintenanceWindow{
+				{Days: []string{"Tue"}, Start: "00:00", End: "01:00", Timezone: "Europe/London"},
+			},
+			time:     time.Date(2017, time.May, 29, 23, 30, 0, 0, time.UTC).In(london),
+			expected: true,
+		},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			s, err := New(config.ScheduleConfig{Interval: time.Minute, MaintenanceWindows: tc.windows})
+			if assert.Nil(t, err) {
+				assert.Equal(t, tc.expected, s.InMaintenanceWindow(tc.time))
+			}
+		})
+	}
+}
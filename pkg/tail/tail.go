@@ -0,0 +1,159 @@
+// Package tail follows a growing file, such as a log, line by line.
+//
+// Files are polled rather than watched, so the tailer works on any filesystem a log may be shipped to. When the
+// file is rotated, replaced or truncated it is reopened and read again from the start.
+package tail
+
+import (
+	"bufio"
+	"io"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	log "github.com/Sirupsen/logrus"
+)
+
+const logComponent = "tail"
+
+// Tailer reads every line of a file, and then each line appended to it.
+type Tailer struct {
+	path         string
+	pollInterval time.Duration
+	handler      func(line string)
+
+	file   *os.File
+	reader *bufio.Reader
+	// offset is the number of bytes read from the current file:
+	offset int64
+	// partial is the start of a line whose newline has not yet been written:
+	partial string
+	log     *log.Entry
+
+	mutex sync.Mutex
+	// synced is set once the file has been read to its end for the first time:
+	synced bool
+}
+
+// New returns a tailer which calls handler with each line of the file at path, without its line ending, checking
+// for new lines every pollInterval.
+func New(path string, pollInterval time.Duration, handler func(line string)) *Tailer {
+	return &Tailer{
+		path:         path,
+		pollInterval: pollInterval,
+		handler:      handler,
+		log:          log.WithFields(log.Fields{"component": logComponent, "path": path}),
+	}
+}
+
+// Run follows the file until stopChan is closed. A file which does not exist yet is waited for.
+func (t *Tailer) Run(stopChan <-chan struct{}) {
+	defer t.close()
+	missing := false
+	for {
+		if t.file == nil {
+			if err := t.open(); err != nil {
+				// Only log the first failure, the file may legitimately not exist until something is logged:
+				if !missing {
+					t.log.Warnf("unable to open file, will retry: %s", err)
+					missing = true
+				}
+				// There is nothing to catch up on in a file which does not exist:
+				if os.IsNotExist(err) {
+					t.setSynced()
+				}
+			} else {
+				missing = false
+			}
+		}
+		if t.file != nil {
+			t.readLines()
+			t.setSynced()
+			if t.replaced() {
+				t.log.Infoln("file was rotated or truncated, reopening")
+				// Anything written to a rotated file just before it was replaced:
+				t.readLines()
+				t.flushPartial()
+				t.close()
+				continue
+			}
+		}
+		select {
+		case <-stopChan:
+			return
+		case <-time.After(t.pollInterval):
+		}
+	}
+}
+
+// HasSynced returns true once every line in the file when Run was called has been handled, or if there was no file.
+func (t *Tailer) HasSynced() bool {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	return t.synced
+}
+
+func (t *Tailer) setSynced() {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	t.synced = true
+}
+
+func (t *Tailer) open() error {
+	f, err := os.Open(t.path)
+	if err != nil {
+		return err
+	}
+	t.file = f
+	t.reader = bufio.NewReader(f)
+	t.offset = 0
+	t.partial = ""
+	return nil
+}
+
+func (t *Tailer) close() {
+	if t.file != nil {
+		t.file.Close()
+		t.file = nil
+	}
+}
+
+// readLines handles every complete line up to the current end of the file.
+func (t *Tailer) readLines() {
+	for {
+		line, err := t.reader.ReadString('\n')
+		t.offset += int64(len(line))
+		if err != nil {
+			if err != io.EOF {
+				t.log.Errorf("error reading file: %s", err)
+			}
+			t.partial += line
+			return
+		}
+		t.handler(strings.TrimRight(t.partial+line, "\r\n"))
+		t.partial = ""
+	}
+}
+
+// flushPartial handles a final line with no newline in a file which will not be written to again.
+func (t *Tailer) flushPartial() {
+	if t.partial != "" {
+		t.handler(strings.TrimRight(t.partial, "\r\n"))
+		t.partial = ""
+	}
+}
+
+// replaced returns true if the path now refers to a different file than the one being read, or the file has been
+// truncated. A file which has been removed but not yet replaced continues to be read.
+func (t *Tailer) replaced() bool {
+	info, err := os.Stat(t.path)
+	if err != nil {
+		return false
+	}
+	current, err := t.file.Stat()
+	if err != nil {
+		return true
+	}
+	return !os.SameFile(info, current) || info.Size() < t.offset
+}
@@ -0,0 +1,112 @@
+package tail
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func appendFile(t *testing.T, path, data string) {
+	f, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	if _, err := f.WriteString(data); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// expectLines waits for the tailer to handle the expected lines.
+func expectLines(t *testing.T, lines <-chan string, expected ...string) {
+	actual := []string{}
+	for range expected {
+		select {
+		case line := <-lines:
+			actual = append(actual, line)
+		case <-time.After(5 * time.Second):
+			t.Fatalf("timed out waiting for lines, expected %v but got %v", expected, actual)
+		}
+	}
+	assert.Equal(t, expected, actual)
+}
+
+func TestTailer(t *testing.T) {
+	dir, err := ioutil.TempDir("", "tail")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "audit.log")
+
+	lines := make(chan string, 100)
+	stopChan := make(chan struct{})
+	defer close(stopChan)
+	tailer := New(path, 10*time.Millisecond, func(line string) { lines <- line })
+
+	// The file does not exist until the tailer is running:
+	assert.False(t, tailer.HasSynced())
+	go tailer.Run(stopChan)
+	appendFile(t, path, "line1\nline2\n")
+	expectLines(t, lines, "line1", "line2")
+	assert.True(t, tailer.HasSynced())
+
+	// Lines are only handled once complete:
+	appendFile(t, path, "line")
+	appendFile(t, path, "3\r\n")
+	expectLines(t, lines, "line3")
+
+	// Rotation:
+	if err := os.Rename(path, path+".1"); err != nil {
+		t.Fatal(err)
+	}
+	appendFile(t, path, "line4\n")
+	expectLines(t, lines, "line4")
+
+	// Truncation:
+	if err := os.Truncate(path, 0); err != nil {
+		t.Fatal(err)
+	}
+	appendFile(t, path, "5\n")
+	expectLines(t, lines, "5")
+
+	select {
+	case line := <-lines:
+		t.Errorf("unexpected line: %s", line)
+	case <-time.After(50 * time.Millisecond):
+	}
+}
+
+func TestTailerHasSynced(t *testing.T) {
+	dir, err := ioutil.TempDir("", "tail")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "audit.log")
+	appendFile(t, path, "line1\nline2\nline3\n")
+
+	stopChan := make(chan struct{})
+	defer close(stopChan)
+	// Lines already in the file are handled before the tailer has synced:
+	handled := 0
+	var tailer *Tailer
+	tailer = New(path, 10*time.Millisecond, func(line string) {
+		assert.False(t, tailer.HasSynced(), "synced before handling %s", line)
+		handled++
+	})
+	go tailer.Run(stopChan)
+
+	deadline := time.Now().Add(5 * time.Second)
+	for !tailer.HasSynced() {
+		if time.Now().After(deadline) {
+			t.Fatal("timed out waiting for tailer to sync")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	assert.Equal(t, 3, handled)
+}
@@ -0,0 +1,7 @@
+// Package version holds the version of the archivist, set at build time.
+package version
+
+// Version is overridden at build time with:
+//
+//	-ldflags "-X github.com/openshift/online/archivist/pkg/version.Version=<version>"
+var Version = "unknown"